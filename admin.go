@@ -0,0 +1,54 @@
+package main
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"os"
+
+	"cinemabooking/auth"
+)
+
+// requestRole is the role a request acts with: admin for requests carrying
+// the ADMIN_API_KEY, the logged-in user's role, or no role for guests
+func requestRole(r *http.Request) (auth.Role, error) {
+	if isAdminRequest(r) {
+		return auth.RoleAdmin, nil
+	}
+	user, err := currentUser(r)
+	if err != nil || user == nil {
+		return "", err
+	}
+	return user.Role, nil
+}
+
+// requirePermission only lets requests through whose role has the given
+// permission. Guests get 401 and users without the permission 403.
+func requirePermission(perm auth.Permission, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		role, err := requestRole(r)
+		if err != nil {
+			log.Printf("Error fetching session: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if role == "" {
+			http.Error(w, "Login required", http.StatusUnauthorized)
+			return
+		}
+		if !role.Can(perm) {
+			log.Printf("Rejected %s request to %s: needs %s", role, r.URL.Path, perm)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isAdminRequest reports whether a request carries the admin key. The key
+// acts as an admin account, e.g. to promote the first admin user.
+func isAdminRequest(r *http.Request) bool {
+	adminKey := os.Getenv("ADMIN_API_KEY")
+	givenKey := r.Header.Get("X-Admin-Key")
+	return adminKey != "" && subtle.ConstantTimeCompare([]byte(givenKey), []byte(adminKey)) == 1
+}
@@ -0,0 +1,66 @@
+// Package auth handles passwords, login sessions and the signed tokens that
+// give guests access to their bookings.
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MinPasswordLength is the shortest password accepted at registration.
+const MinPasswordLength = 8
+
+// ErrWeakPassword is returned for passwords shorter than MinPasswordLength.
+var ErrWeakPassword = errors.New("auth: password is too short")
+
+// HashPassword returns the bcrypt hash to store for a password.
+func HashPassword(password string) (string, error) {
+	if len(password) < MinPasswordLength {
+		return "", ErrWeakPassword
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// CheckPassword reports whether password matches a stored hash.
+func CheckPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// NewSessionToken returns a random session token to give the client.
+func NewSessionToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashSessionToken is what's stored for a session token, so a leaked
+// sessions table can't be used to log in.
+func HashSessionToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// BookingToken signs a booking reference, giving whoever holds the token
+// access to that booking.
+func BookingToken(key []byte, reference string) string {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte("booking:" + reference))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+// CheckBookingToken reports whether token was issued for reference.
+func CheckBookingToken(key []byte, reference, token string) bool {
+	if len(key) == 0 || token == "" {
+		return false
+	}
+	return hmac.Equal([]byte(token), []byte(BookingToken(key, reference)))
+}
@@ -0,0 +1,86 @@
+package auth
+
+import "errors"
+
+// Role is what a user is allowed to do.
+type Role string
+
+// Roles, from least to most privileged. Each role can do everything the
+// roles before it can.
+const (
+	RoleCustomer  Role = "customer"
+	RoleBoxOffice Role = "box_office"
+	RoleManager   Role = "manager"
+	RoleAdmin     Role = "admin"
+)
+
+// Permission names an action restricted to some roles.
+type Permission string
+
+// Permissions checked by the staff routes
+const (
+	// Box office
+	PermViewBookings Permission = "view_bookings"
+	PermSellTickets  Permission = "sell_tickets"
+	PermRefund       Permission = "refund"
+	PermCheckIn      Permission = "check_in"
+	// Managers
+	PermManagePrices      Permission = "manage_prices"
+	PermManageSchedules   Permission = "manage_schedules"
+	PermManageVouchers    Permission = "manage_vouchers"
+	PermManageConcessions Permission = "manage_concessions"
+	// Admins
+	PermManageUsers Permission = "manage_users"
+)
+
+// ErrUnknownRole is returned by ParseRole for names that aren't a role.
+var ErrUnknownRole = errors.New("auth: unknown role")
+
+// Permissions each role adds to those of the role below it
+var granted = map[Role][]Permission{
+	RoleCustomer:  nil,
+	RoleBoxOffice: {PermViewBookings, PermSellTickets, PermRefund, PermCheckIn},
+	RoleManager:   {PermManagePrices, PermManageSchedules, PermManageVouchers, PermManageConcessions},
+	RoleAdmin:     {PermManageUsers},
+}
+
+var hierarchy = []Role{RoleCustomer, RoleBoxOffice, RoleManager, RoleAdmin}
+
+// Roles lists every role, least privileged first.
+func Roles() []Role {
+	return append([]Role(nil), hierarchy...)
+}
+
+// ParseRole checks a role name.
+func ParseRole(name string) (Role, error) {
+	role := Role(name)
+	if _, ok := granted[role]; !ok {
+		return "", ErrUnknownRole
+	}
+	return role, nil
+}
+
+// Can reports whether the role has a permission, directly or through a less
+// privileged role.
+func (r Role) Can(p Permission) bool {
+	if _, ok := granted[r]; !ok {
+		return false
+	}
+	for _, role := range hierarchy {
+		for _, perm := range granted[role] {
+			if perm == p {
+				return true
+			}
+		}
+		if role == r {
+			break
+		}
+	}
+	return false
+}
+
+// IsStaff reports whether the role is above customer.
+func (r Role) IsStaff() bool {
+	_, ok := granted[r]
+	return ok && r != RoleCustomer
+}
@@ -0,0 +1,524 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"cinemabooking/concessions"
+	"cinemabooking/money"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/gorilla/mux"
+)
+
+var (
+	errConcessionNotFound   = errors.New("concession not found")
+	errConcessionOutOfStock = errors.New("not enough left in stock")
+)
+
+// Concession categories
+var concessionCategories = map[string]bool{"snack": true, "drink": true, "combo": true}
+
+// ConcessionItem is a food or drink item on sale
+type ConcessionItem struct {
+	ID          int         `json:"id"`
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Category    string      `json:"category"`
+	Price       money.Money `json:"price"`
+	Stock       int         `json:"stock"`
+	Active      bool        `json:"active"`
+}
+
+// BookedConcession is a concession item ordered with a booking, at the price
+// it was sold for
+type BookedConcession struct {
+	ItemID    int         `json:"item_id"`
+	Name      string      `json:"name"`
+	Quantity  int         `json:"quantity"`
+	UnitPrice money.Money `json:"unit_price"`
+	Amount    money.Money `json:"amount"`
+}
+
+// ConcessionPickup is a booking's food and drink order as seen at the
+// concessions stand
+type ConcessionPickup struct {
+	Reference   string             `json:"reference"`
+	PickupCode  string             `json:"pickup_code"`
+	Status      string             `json:"status"`
+	Items       []BookedConcession `json:"items"`
+	CollectedAt *time.Time         `json:"collected_at,omitempty"`
+}
+
+// List the concession items on sale
+func getConcessions(w http.ResponseWriter, r *http.Request) {
+	items, err := loadConcessions(true)
+	if err != nil {
+		log.Printf("Error fetching concessions: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(items)
+}
+
+// List every concession item, including those taken off sale
+func getAllConcessions(w http.ResponseWriter, r *http.Request) {
+	items, err := loadConcessions(false)
+	if err != nil {
+		log.Printf("Error fetching concessions: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(items)
+}
+
+// loadConcessions lists the catalogue by category and name
+func loadConcessions(activeOnly bool) ([]ConcessionItem, error) {
+	query := "SELECT id, name, COALESCE(description, ''), category, price, stock, active FROM concessions"
+	if activeOnly {
+		query += " WHERE active = TRUE"
+	}
+	query += " ORDER BY category, name"
+
+	rows, err := dbConn.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []ConcessionItem{}
+	for rows.Next() {
+		item := ConcessionItem{Price: noMoney()}
+		if err := rows.Scan(&item.ID, &item.Name, &item.Description, &item.Category, &item.Price, &item.Stock, &item.Active); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// concessionChanges are the fields of a concession item an admin request
+// sets. Fields left out are not changed.
+type concessionChanges struct {
+	Name        *string      `json:"name"`
+	Description *string      `json:"description"`
+	Category    *string      `json:"category"`
+	Price       *money.Money `json:"price"`
+	Stock       *int         `json:"stock"`
+	Active      *bool        `json:"active"`
+}
+
+// validate checks the fields that are set
+func (c concessionChanges) validate() string {
+	if c.Name != nil && *c.Name == "" {
+		return "Name must not be empty"
+	}
+	if c.Category != nil && !concessionCategories[*c.Category] {
+		return "Category must be snack, drink or combo"
+	}
+	if c.Price != nil && c.Price.IsNegative() {
+		return "Price must not be negative"
+	}
+	if c.Stock != nil && *c.Stock < 0 {
+		return "Stock must not be negative"
+	}
+	return ""
+}
+
+// Add an item to the concessions catalogue
+func createConcession(w http.ResponseWriter, r *http.Request) {
+	var changes concessionChanges
+	err := json.NewDecoder(r.Body).Decode(&changes)
+	if err != nil {
+		log.Printf("Error decoding request: %v", err)
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	if changes.Name == nil || changes.Category == nil || changes.Price == nil {
+		http.Error(w, "Name, category and price are required", http.StatusBadRequest)
+		return
+	}
+	if msg := changes.validate(); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	item := ConcessionItem{
+		Name:     *changes.Name,
+		Category: *changes.Category,
+		Price:    *changes.Price,
+		Active:   true,
+	}
+	if changes.Description != nil {
+		item.Description = *changes.Description
+	}
+	if changes.Stock != nil {
+		item.Stock = *changes.Stock
+	}
+	if changes.Active != nil {
+		item.Active = *changes.Active
+	}
+
+	result, err := dbConn.Exec(`
+		INSERT INTO concessions (name, description, category, price, stock, active)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, item.Name, item.Description, item.Category, item.Price, item.Stock, item.Active)
+	if err == nil {
+		var id int64
+		id, err = result.LastInsertId()
+		item.ID = int(id)
+	}
+	if err != nil {
+		log.Printf("Error creating concession: %v", err)
+		http.Error(w, "Error creating concession", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Added concession %d: %s at %s", item.ID, item.Name, item.Price)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(item)
+}
+
+// Change a concession item's details, price, stock level or whether it is on
+// sale. Existing bookings keep what they paid.
+func updateConcession(w http.ResponseWriter, r *http.Request) {
+	itemID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid concession ID", http.StatusBadRequest)
+		return
+	}
+
+	var changes concessionChanges
+	err = json.NewDecoder(r.Body).Decode(&changes)
+	if err != nil {
+		log.Printf("Error decoding request: %v", err)
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	if msg := changes.validate(); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	tx, err := dbConn.Begin()
+	if err != nil {
+		log.Printf("Error beginning transaction: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	item := ConcessionItem{Price: noMoney()}
+	err = tx.QueryRow(`
+		SELECT id, name, COALESCE(description, ''), category, price, stock, active
+		FROM concessions
+		WHERE id = ?
+		FOR UPDATE
+	`, itemID).Scan(&item.ID, &item.Name, &item.Description, &item.Category, &item.Price, &item.Stock, &item.Active)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Concession not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching concession %d: %v", itemID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	if changes.Name != nil {
+		item.Name = *changes.Name
+	}
+	if changes.Description != nil {
+		item.Description = *changes.Description
+	}
+	if changes.Category != nil {
+		item.Category = *changes.Category
+	}
+	if changes.Price != nil {
+		item.Price = *changes.Price
+	}
+	if changes.Stock != nil {
+		item.Stock = *changes.Stock
+	}
+	if changes.Active != nil {
+		item.Active = *changes.Active
+	}
+
+	_, err = tx.Exec(`
+		UPDATE concessions SET name = ?, description = ?, category = ?, price = ?, stock = ?, active = ?
+		WHERE id = ?
+	`, item.Name, item.Description, item.Category, item.Price, item.Stock, item.Active, itemID)
+	if err != nil {
+		log.Printf("Error updating concession %d: %v", itemID, err)
+		http.Error(w, "Error updating concession", http.StatusInternalServerError)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Updated concession %d: %s at %s, %d in stock", item.ID, item.Name, item.Price, item.Stock)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(item)
+}
+
+// priceConcessions prices an order at the current prices and checks it is on
+// sale and in stock. With lock set the items are locked for update.
+func priceConcessions(q queryer, lines []concessions.Line, lock bool) ([]BookedConcession, error) {
+	lines, err := concessions.Normalize(lines)
+	if err != nil {
+		return nil, err
+	}
+
+	query := "SELECT name, price, stock, active FROM concessions WHERE id = ?"
+	if lock {
+		query += " FOR UPDATE"
+	}
+
+	var items []BookedConcession
+	for _, line := range lines {
+		item := BookedConcession{ItemID: line.ItemID, Quantity: line.Quantity, UnitPrice: noMoney()}
+		var stock int
+		var active bool
+		err := q.QueryRow(query, line.ItemID).Scan(&item.Name, &item.UnitPrice, &stock, &active)
+		if err == sql.ErrNoRows || (err == nil && !active) {
+			return nil, errConcessionNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		if stock < line.Quantity {
+			return nil, fmt.Errorf("%s: %w", item.Name, errConcessionOutOfStock)
+		}
+
+		item.Amount = item.UnitPrice.Mul(item.Quantity)
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// reserveConcessionsTx takes an order out of stock at the current prices and
+// returns the ordered items
+func reserveConcessionsTx(tx *sql.Tx, lines []concessions.Line) ([]BookedConcession, error) {
+	items, err := priceConcessions(tx, lines, true)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		_, err = tx.Exec("UPDATE concessions SET stock = stock - ? WHERE id = ?", item.Quantity, item.ItemID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return items, nil
+}
+
+// attachConcessionsTx records the items ordered with a booking and gives it
+// a pickup code. It returns the pickup code, or "" when nothing was ordered.
+func attachConcessionsTx(tx *sql.Tx, bookingID int, items []BookedConcession) (string, error) {
+	if len(items) == 0 {
+		return "", nil
+	}
+
+	for _, item := range items {
+		_, err := tx.Exec(`
+			INSERT INTO booking_concessions (booking_id, concession_id, name, quantity, unit_price)
+			VALUES (?, ?, ?, ?, ?)
+		`, bookingID, item.ItemID, item.Name, item.Quantity, item.UnitPrice)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	for attempt := 0; attempt < referenceAttempts; attempt++ {
+		code, err := concessions.NewPickupCode()
+		if err != nil {
+			return "", err
+		}
+		_, err = tx.Exec("UPDATE bookings SET pickup_code = ? WHERE id = ?", code, bookingID)
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == errDuplicateEntry {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return code, nil
+	}
+	return "", errors.New("no unused pickup code found")
+}
+
+// releaseConcessionsTx puts the items of a cancelled booking back in stock,
+// unless they have already been collected
+func releaseConcessionsTx(tx *sql.Tx, bookingID int) error {
+	_, err := tx.Exec(`
+		UPDATE concessions c
+		JOIN booking_concessions bc ON bc.concession_id = c.id
+		JOIN bookings b ON b.id = bc.booking_id
+		SET c.stock = c.stock + bc.quantity
+		WHERE bc.booking_id = ? AND b.concessions_collected_at IS NULL
+	`, bookingID)
+	return err
+}
+
+// moveConcessionsTx moves the food and drink order of an exchanged booking,
+// with its pickup code, to the new booking
+func moveConcessionsTx(tx *sql.Tx, fromBookingID, toBookingID int) error {
+	var pickupCode sql.NullString
+	var collectedAt sql.NullTime
+	err := tx.QueryRow("SELECT pickup_code, concessions_collected_at FROM bookings WHERE id = ?", fromBookingID).Scan(&pickupCode, &collectedAt)
+	if err != nil || !pickupCode.Valid {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE booking_concessions SET booking_id = ? WHERE booking_id = ?", toBookingID, fromBookingID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE bookings SET pickup_code = NULL, concessions_collected_at = NULL WHERE id = ?", fromBookingID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE bookings SET pickup_code = ?, concessions_collected_at = ? WHERE id = ?", pickupCode, collectedAt, toBookingID)
+	return err
+}
+
+// bookingConcessions lists the items ordered with a booking
+func bookingConcessions(q queryer, bookingID int) ([]BookedConcession, error) {
+	rows, err := q.Query(`
+		SELECT concession_id, name, quantity, unit_price
+		FROM booking_concessions
+		WHERE booking_id = ?
+		ORDER BY id
+	`, bookingID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []BookedConcession
+	for rows.Next() {
+		item := BookedConcession{UnitPrice: noMoney()}
+		if err := rows.Scan(&item.ItemID, &item.Name, &item.Quantity, &item.UnitPrice); err != nil {
+			return nil, err
+		}
+		item.Amount = item.UnitPrice.Mul(item.Quantity)
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// writeConcessionError turns a concession order error into an HTTP response
+func writeConcessionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, concessions.ErrInvalidItem), errors.Is(err, concessions.ErrInvalidQuantity):
+		http.Error(w, "Invalid concession order: "+err.Error(), http.StatusBadRequest)
+	case errors.Is(err, errConcessionNotFound):
+		http.Error(w, "Concession item not found", http.StatusBadRequest)
+	case errors.Is(err, errConcessionOutOfStock):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.Printf("Error reserving concessions: %v", err)
+		http.Error(w, "Error reserving concessions", http.StatusInternalServerError)
+	}
+}
+
+// Look up a food and drink order by its pickup code
+func getConcessionPickup(w http.ResponseWriter, r *http.Request) {
+	pickup, bookingID, err := loadConcessionPickup(mux.Vars(r)["code"])
+	if err == sql.ErrNoRows {
+		http.Error(w, "Pickup code not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching pickup for booking %d: %v", bookingID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pickup)
+}
+
+// Hand over a food and drink order. Each order can only be collected once.
+func collectConcessionPickup(w http.ResponseWriter, r *http.Request) {
+	pickup, bookingID, err := loadConcessionPickup(mux.Vars(r)["code"])
+	if err == sql.ErrNoRows {
+		http.Error(w, "Pickup code not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching pickup for booking %d: %v", bookingID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if pickup.Status != "confirmed" {
+		http.Error(w, "Booking is not confirmed", http.StatusConflict)
+		return
+	}
+
+	collectedAt := time.Now().UTC()
+	result, err := dbConn.Exec(`
+		UPDATE bookings SET concessions_collected_at = ?
+		WHERE id = ? AND concessions_collected_at IS NULL AND status = 'confirmed'
+	`, collectedAt, bookingID)
+	if err != nil {
+		log.Printf("Error collecting pickup for booking %d: %v", bookingID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		http.Error(w, "Order has already been collected", http.StatusConflict)
+		return
+	}
+
+	log.Printf("Concessions for booking %d collected", bookingID)
+
+	collected := inCinemaTime(collectedAt)
+	pickup.CollectedAt = &collected
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pickup)
+}
+
+// loadConcessionPickup finds the booking with a pickup code and its order
+func loadConcessionPickup(code string) (ConcessionPickup, int, error) {
+	var pickup ConcessionPickup
+	code, err := concessions.ParsePickupCode(code)
+	if err != nil {
+		return pickup, 0, sql.ErrNoRows
+	}
+
+	var bookingID int
+	var collectedAt sql.NullTime
+	err = dbConn.QueryRow(`
+		SELECT id, reference, pickup_code, status, concessions_collected_at FROM bookings WHERE pickup_code = ?
+	`, code).Scan(&bookingID, &pickup.Reference, &pickup.PickupCode, &pickup.Status, &collectedAt)
+	if err != nil {
+		return pickup, 0, err
+	}
+	if collectedAt.Valid {
+		collected := inCinemaTime(collectedAt.Time)
+		pickup.CollectedAt = &collected
+	}
+
+	pickup.Items, err = bookingConcessions(dbConn, bookingID)
+	return pickup, bookingID, err
+}
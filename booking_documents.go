@@ -0,0 +1,156 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+
+	"cinemabooking/documents"
+)
+
+// Serve a printable PDF ticket for a confirmed booking
+func getTicketPDF(w http.ResponseWriter, r *http.Request) {
+	bookingID, ok := authorizeBooking(w, r)
+	if !ok {
+		return
+	}
+
+	booking, status, err := loadBookingDocument(bookingID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Booking not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching booking %d for ticket: %v", bookingID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if status != "confirmed" {
+		http.Error(w, "Booking is not confirmed", http.StatusConflict)
+		return
+	}
+
+	// The QR code is only printed when tickets can be signed
+	if key := ticketKey(); len(key) > 0 {
+		payload, err := ticketPayload(dbConn, bookingID)
+		if err == nil {
+			booking.QRCode, err = ticketQRCode(payload, key)
+		}
+		if err != nil {
+			log.Printf("Error creating ticket QR code for booking %d: %v", bookingID, err)
+			http.Error(w, "Error creating ticket", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	pdf, err := documents.Ticket(booking)
+	if err != nil {
+		log.Printf("Error rendering ticket for booking %d: %v", bookingID, err)
+		http.Error(w, "Error creating ticket", http.StatusInternalServerError)
+		return
+	}
+	writePDF(w, "ticket-"+booking.Reference+".pdf", pdf)
+}
+
+// Serve a PDF receipt for a booking
+func getReceiptPDF(w http.ResponseWriter, r *http.Request) {
+	bookingID, ok := authorizeBooking(w, r)
+	if !ok {
+		return
+	}
+
+	booking, _, err := loadBookingDocument(bookingID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Booking not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching booking %d for receipt: %v", bookingID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	pdf, err := documents.Receipt(booking)
+	if err != nil {
+		log.Printf("Error rendering receipt for booking %d: %v", bookingID, err)
+		http.Error(w, "Error creating receipt", http.StatusInternalServerError)
+		return
+	}
+	writePDF(w, "receipt-"+booking.Reference+".pdf", pdf)
+}
+
+// loadBookingDocument loads what tickets and receipts show about a booking,
+// along with the booking's status
+func loadBookingDocument(bookingID int) (documents.Booking, string, error) {
+	booking, err := bookingEmail(dbConn, bookingID)
+	if err != nil {
+		return documents.Booking{}, "", err
+	}
+
+	var status, pickupCode string
+	doc := documents.Booking{
+		Reference:  booking.Reference,
+		Customer:   booking.Name,
+		Email:      booking.Email,
+		MovieTitle: booking.MovieTitle,
+		Screen:     booking.Screen,
+		StartTime:  booking.StartTime,
+		Seats:      booking.Seats,
+		Currency:   booking.Total.Currency,
+		TaxRate:    receiptTaxRate(),
+	}
+	err = dbConn.QueryRow(`
+		SELECT status, booking_time, COALESCE(pickup_code, '') FROM bookings WHERE id = ?
+	`, bookingID).Scan(&status, &doc.BookedAt, &pickupCode)
+	if err != nil {
+		return doc, "", err
+	}
+	doc.BookedAt = inCinemaTime(doc.BookedAt)
+	doc.PickupCode = pickupCode
+
+	items, err := bookingItems(dbConn, bookingID)
+	if err != nil {
+		return doc, "", err
+	}
+	doc.Items = receiptLines(booking.MovieTitle, items)
+	for _, item := range items {
+		switch item.Kind {
+		case itemAddOn:
+			doc.Extras = append(doc.Extras, fmt.Sprintf("%d x %s", item.Quantity, item.Description))
+		case itemTax:
+			doc.Taxes = append(doc.Taxes, documents.TaxLine{Description: item.Description, Amount: item.Amount, Included: item.Included})
+		}
+	}
+	return doc, status, nil
+}
+
+// receiptLines turns booking items into receipt lines. Seats at the same
+// price share a line; taxes are listed separately under the totals.
+func receiptLines(movieTitle string, items []BookingItem) []documents.LineItem {
+	var lines []documents.LineItem
+	seatLines := make(map[int64]int)
+	for _, item := range items {
+		if item.Kind == itemTax || item.Included {
+			continue
+		}
+		if item.Kind == itemSeat {
+			if i, ok := seatLines[item.UnitAmount.Cents]; ok {
+				lines[i].Quantity += item.Quantity
+				continue
+			}
+			seatLines[item.UnitAmount.Cents] = len(lines)
+			lines = append(lines, documents.LineItem{Description: "Admission: " + movieTitle, Quantity: item.Quantity, UnitPrice: item.UnitAmount})
+			continue
+		}
+		lines = append(lines, documents.LineItem{Description: item.Description, Quantity: item.Quantity, UnitPrice: item.UnitAmount})
+	}
+	return lines
+}
+
+func writePDF(w http.ResponseWriter, filename string, pdf []byte) {
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", `inline; filename="`+filename+`"`)
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Write(pdf)
+}
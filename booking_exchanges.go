@@ -0,0 +1,356 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"cinemabooking/auth"
+	"cinemabooking/money"
+	"cinemabooking/seating"
+)
+
+// BookingExchange is the result of moving a booking to another show
+type BookingExchange struct {
+	OriginalBookingID int     `json:"original_booking_id"`
+	Booking           Booking `json:"booking"`
+	// Positive when the customer owes more, negative when they are due a
+	// refund. Gift vouchers used on the original booking are spent first.
+	PriceDifference money.Money `json:"price_difference"`
+}
+
+// Exchange a booking for the same number of seats on another show of the
+// same movie
+func exchangeBooking(w http.ResponseWriter, r *http.Request) {
+	bookingID, ok := authorizeBooking(w, r)
+	if !ok {
+		return
+	}
+
+	var exchangeRequest struct {
+		TargetShowID int   `json:"target_show_id"`
+		SeatIDs      []int `json:"seat_ids"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&exchangeRequest)
+	if err != nil {
+		log.Printf("Error decoding request: %v", err)
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("Exchanging booking %d to show %d", bookingID, exchangeRequest.TargetShowID)
+
+	tx, err := dbConn.Begin()
+	if err != nil {
+		log.Printf("Error beginning transaction: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	original := Booking{TotalAmount: noMoney(), VoucherAmount: noMoney()}
+	var ownerID *int
+	var channel string
+	err = tx.QueryRow(`
+		SELECT id, show_id, user_id, COALESCE(user_name, ''), COALESCE(user_email, ''), total_amount, voucher_amount, status, channel
+		FROM bookings
+		WHERE id = ?
+		FOR UPDATE
+	`, bookingID).Scan(&original.ID, &original.ShowID, &ownerID, &original.UserName, &original.UserEmail, &original.TotalAmount, &original.VoucherAmount, &original.Status, &channel)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Booking not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching booking: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if original.Status != "confirmed" {
+		http.Error(w, "Only confirmed bookings can be exchanged", http.StatusConflict)
+		return
+	}
+	if exchangeRequest.TargetShowID == original.ShowID {
+		http.Error(w, "Booking is already for this show", http.StatusBadRequest)
+		return
+	}
+
+	places, prefs, err := bookedPlaces(tx, bookingID)
+	if err != nil {
+		log.Printf("Error fetching booked seats: %v", err)
+		http.Error(w, "Error fetching seats", http.StatusInternalServerError)
+		return
+	}
+	if len(places) == 0 {
+		http.Error(w, "Booking has no seats to exchange", http.StatusConflict)
+		return
+	}
+
+	// The target must be a bookable show of the same movie
+	var originalMovieID, targetMovieID int
+	targetPrice := noMoney()
+	var enforceSeatGaps bool
+	var targetStatus string
+	var targetStart time.Time
+	err = tx.QueryRow("SELECT movie_id FROM shows WHERE id = ?", original.ShowID).Scan(&originalMovieID)
+	if err != nil {
+		log.Printf("Error fetching original show: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	err = tx.QueryRow(`
+		SELECT movie_id, price, enforce_seat_gaps, status, start_time FROM shows WHERE id = ?
+	`, exchangeRequest.TargetShowID).Scan(&targetMovieID, &targetPrice, &enforceSeatGaps, &targetStatus, &targetStart)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Target show not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching target show: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if targetMovieID != originalMovieID {
+		http.Error(w, "Bookings can only be exchanged for a show of the same movie", http.StatusBadRequest)
+		return
+	}
+	if targetStatus == "cancelled" {
+		http.Error(w, "Show has been cancelled", http.StatusConflict)
+		return
+	}
+	if !targetStart.After(time.Now()) {
+		http.Error(w, "Target show has already started", http.StatusConflict)
+		return
+	}
+	targetPrice, err = currentShowPrice(tx, exchangeRequest.TargetShowID, targetPrice)
+	if err != nil {
+		log.Printf("Error pricing target show: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	// Without an explicit choice the customer keeps the same seats if they're
+	// free, or gets the best block of the same size
+	seatIDs := exchangeRequest.SeatIDs
+	if len(seatIDs) == 0 {
+		seatIDs, err = equivalentSeats(tx, exchangeRequest.TargetShowID, places, prefs, enforceSeatGaps)
+		if err != nil {
+			log.Printf("Error choosing seats: %v", err)
+			http.Error(w, "Error fetching seats", http.StatusInternalServerError)
+			return
+		}
+		if len(seatIDs) == 0 {
+			http.Error(w, "No equivalent seats available on the target show", http.StatusConflict)
+			return
+		}
+	} else if len(seatIDs) != len(places) {
+		http.Error(w, "Select "+strconv.Itoa(len(places))+" seats for the exchange", http.StatusBadRequest)
+		return
+	}
+
+	err = reserveSeatsTx(tx, exchangeRequest.TargetShowID, seatIDs, "", enforceSeatGaps)
+	if err != nil {
+		writeSeatError(w, err)
+		return
+	}
+
+	// Release the original seats
+	_, err = tx.Exec("UPDATE seats SET status = 'available', booking_id = NULL WHERE booking_id = ?", bookingID)
+	if err != nil {
+		log.Printf("Error releasing seats: %v", err)
+		http.Error(w, "Error releasing seats", http.StatusInternalServerError)
+		return
+	}
+	_, err = tx.Exec("UPDATE bookings SET status = 'exchanged' WHERE id = ?", bookingID)
+	if err != nil {
+		log.Printf("Error updating booking: %v", err)
+		http.Error(w, "Error updating booking", http.StatusInternalServerError)
+		return
+	}
+
+	// Book the new seats. Food and drink ordered with the original booking
+	// moves across at the price paid, and fees and taxes are worked out again
+	// for the channel it was sold through.
+	orderedConcessions, err := bookingConcessions(tx, bookingID)
+	if err != nil {
+		log.Printf("Error fetching concessions: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	items, err := quoteItems(tx, exchangeRequest.TargetShowID, targetPrice, seatIDs, orderedConcessions, channel)
+	if err != nil {
+		log.Printf("Error pricing booking: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	totalAmount := itemsTotal(items)
+	bookingTime := time.Now().UTC()
+	newBookingID, reference, err := insertBookingTx(tx, exchangeRequest.TargetShowID, ownerID, original.UserName, original.UserEmail, channel, items, bookingTime)
+	if err != nil {
+		log.Printf("Error creating booking: %v", err)
+		http.Error(w, "Error creating booking", http.StatusInternalServerError)
+		return
+	}
+
+	err = assignSeatsTx(tx, newBookingID, seatIDs)
+	if err != nil {
+		log.Printf("Error updating seats: %v", err)
+		http.Error(w, "Error updating seat status", http.StatusInternalServerError)
+		return
+	}
+
+	err = moveConcessionsTx(tx, bookingID, newBookingID)
+	if err != nil {
+		log.Printf("Error moving concessions: %v", err)
+		http.Error(w, "Error creating booking", http.StatusInternalServerError)
+		return
+	}
+
+	// Vouchers used on the original booking pay for the new one first
+	voucherAmount, err := moveVouchersTx(tx, bookingID, newBookingID, totalAmount)
+	if err != nil {
+		log.Printf("Error moving vouchers: %v", err)
+		http.Error(w, "Error creating booking", http.StatusInternalServerError)
+		return
+	}
+
+	// The difference is in what the customer pays beyond their vouchers
+	priceDifference := totalAmount.Sub(voucherAmount).Sub(original.TotalAmount.Sub(original.VoucherAmount))
+	_, err = tx.Exec(`
+		INSERT INTO booking_exchanges (original_booking_id, new_booking_id, price_difference)
+		VALUES (?, ?, ?)
+	`, bookingID, newBookingID, priceDifference)
+	if err != nil {
+		log.Printf("Error recording exchange: %v", err)
+		http.Error(w, "Error recording exchange", http.StatusInternalServerError)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Exchanged booking %d for booking %d (difference %s)", bookingID, newBookingID, priceDifference)
+
+	// The freed seats can go to anyone waiting for the original show
+	if _, err := offerWaitlistSeats(original.ShowID); err != nil {
+		log.Printf("Error offering seats to the waitlist for show %d: %v", original.ShowID, err)
+	}
+
+	sendBookingConfirmation(newBookingID)
+
+	exchangedFrom := bookingID
+	exchange := BookingExchange{
+		OriginalBookingID: bookingID,
+		Booking: Booking{
+			ID:            newBookingID,
+			Reference:     reference,
+			ShowID:        exchangeRequest.TargetShowID,
+			UserName:      original.UserName,
+			UserEmail:     original.UserEmail,
+			SeatIDs:       seatIDs,
+			TotalAmount:   totalAmount,
+			Currency:      cinemaCurrency(),
+			BookingTime:   inCinemaTime(bookingTime),
+			Status:        "confirmed",
+			Items:         items,
+			VoucherAmount: voucherAmount,
+			Concessions:   orderedConcessions,
+			ExchangedFrom: &exchangedFrom,
+		},
+		PriceDifference: priceDifference,
+	}
+	if ownerID == nil {
+		exchange.Booking.AccessToken = auth.BookingToken(bookingAccessKey(), reference)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(exchange)
+}
+
+// bookedPlaces locks a booking's seats and returns their positions, along with
+// the seating preferences to use if the same positions aren't free
+func bookedPlaces(tx *sql.Tx, bookingID int) ([]seating.Place, seating.Preferences, error) {
+	rows, err := tx.Query(`
+		SELECT row_name, seat_number, category, accessible
+		FROM seats
+		WHERE booking_id = ?
+		ORDER BY row_name, seat_number
+		FOR UPDATE
+	`, bookingID)
+	if err != nil {
+		return nil, seating.Preferences{}, err
+	}
+	defer rows.Close()
+
+	var places []seating.Place
+	var prefs seating.Preferences
+	categories := make(map[string]bool)
+	for rows.Next() {
+		var place seating.Place
+		var category string
+		var accessible bool
+		if err := rows.Scan(&place.Row, &place.Number, &category, &accessible); err != nil {
+			return nil, prefs, err
+		}
+		places = append(places, place)
+		categories[category] = true
+		prefs.Accessible = prefs.Accessible || accessible
+		if len(prefs.PreferredRows) == 0 || prefs.PreferredRows[len(prefs.PreferredRows)-1] != place.Row {
+			prefs.PreferredRows = append(prefs.PreferredRows, place.Row)
+		}
+	}
+
+	prefs.PartySize = len(places)
+	// Keep the category only when the whole booking was in one
+	if len(categories) == 1 {
+		for category := range categories {
+			prefs.Category = category
+		}
+	}
+	return places, prefs, rows.Err()
+}
+
+// equivalentSeats picks seats on the target show for an exchange: the same
+// positions when they're all free, otherwise the best suggested block.
+// It returns no seats when nothing suitable is free.
+func equivalentSeats(tx *sql.Tx, showID int, places []seating.Place, prefs seating.Preferences, enforceSeatGaps bool) ([]int, error) {
+	err := releaseExpiredHolds(tx, showID)
+	if err != nil {
+		return nil, err
+	}
+
+	seatRows, err := loadSeatRows(tx, showID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	engine := seatRulesForShow(enforceSeatGaps)
+	seats, ok := seating.SamePlaces(seatRows, places)
+	if ok {
+		var ids []int
+		for _, seat := range seats {
+			ids = append(ids, seat.ID)
+		}
+		ok = engine.Evaluate(seatRows, ids) == nil
+	}
+	if !ok {
+		block, found := seating.Suggest(seatRows, prefs, seating.DefaultWeights, engine)
+		if !found {
+			return nil, nil
+		}
+		seats = block.Seats
+	}
+
+	var seatIDs []int
+	for _, seat := range seats {
+		seatIDs = append(seatIDs, seat.ID)
+	}
+	return seatIDs, nil
+}
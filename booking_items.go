@@ -0,0 +1,241 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+
+	"cinemabooking/money"
+	"cinemabooking/pricing"
+)
+
+// Kinds of booking item
+const (
+	itemSeat     = pricing.KindSeat
+	itemFee      = pricing.KindFee
+	itemDiscount = pricing.KindDiscount
+	itemTax      = pricing.KindTax
+	itemAddOn    = pricing.KindAddOn
+)
+
+// BookingItem is one line of what a booking costs: a seat, fee, discount,
+// tax or add-on. A booking's total is the sum of its items, so it can always
+// be rebuilt from them.
+type BookingItem = pricing.Item
+
+// cinemaCurrency is the ISO 4217 code prices are in, from CURRENCY (default USD)
+func cinemaCurrency() string {
+	return money.ParseCurrency(os.Getenv("CURRENCY"))
+}
+
+// checkStoredCurrency makes sure every stored amount is in the cinema's
+// currency. Amounts are scanned in CURRENCY, so it can't change once there
+// are bookings.
+func checkStoredCurrency(q queryer) error {
+	var stored string
+	err := q.QueryRow(`
+		SELECT currency FROM bookings WHERE currency IS NOT NULL AND currency <> ?
+		UNION SELECT currency FROM booking_items WHERE currency <> ?
+		LIMIT 1
+	`, cinemaCurrency(), cinemaCurrency()).Scan(&stored)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("bookings are stored in %s but CURRENCY is %s", stored, cinemaCurrency())
+}
+
+// noMoney is zero in the cinema's currency, for scanning amounts into
+func noMoney() money.Money {
+	return money.New(0, cinemaCurrency())
+}
+
+// seatItems prices each of a show's seats at the show's ticket price
+func seatItems(q queryer, showID int, seatIDs []int, price money.Money) ([]BookingItem, error) {
+	items := make([]BookingItem, 0, len(seatIDs))
+	for _, seatID := range seatIDs {
+		var row string
+		var number int
+		err := q.QueryRow("SELECT row_name, seat_number FROM seats WHERE id = ? AND show_id = ?", seatID, showID).Scan(&row, &number)
+		if err == sql.ErrNoRows {
+			return nil, errSeatNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		seatID := seatID
+		items = append(items, BookingItem{
+			Kind:        itemSeat,
+			Description: fmt.Sprintf("Seat %s%d", row, number),
+			SeatID:      &seatID,
+			Quantity:    1,
+			UnitAmount:  price,
+			Amount:      price,
+		})
+	}
+	return items, nil
+}
+
+// concessionItems lists food and drink ordered with a booking as add-ons
+func concessionItems(ordered []BookedConcession) []BookingItem {
+	items := make([]BookingItem, 0, len(ordered))
+	for _, concession := range ordered {
+		concessionID := concession.ItemID
+		items = append(items, BookingItem{
+			Kind:         itemAddOn,
+			Description:  concession.Name,
+			ConcessionID: &concessionID,
+			Quantity:     concession.Quantity,
+			UnitAmount:   concession.UnitPrice,
+			Amount:       concession.Amount,
+		})
+	}
+	return items
+}
+
+// quoteItems prices a booking of seats at a show's ticket price, with any
+// food and drink, and adds the fees of the sales channel and the taxes. It
+// is what a booking is charged and what a quote shows.
+func quoteItems(q queryer, showID int, price money.Money, seatIDs []int, ordered []BookedConcession, channel string) ([]BookingItem, error) {
+	items, err := seatItems(q, showID, seatIDs, price)
+	if err != nil {
+		return nil, err
+	}
+	items = append(items, concessionItems(ordered)...)
+	return priceItems(items, channel), nil
+}
+
+// itemsTotal adds up the items that count towards a booking's total
+func itemsTotal(items []BookingItem) money.Money {
+	return noMoney().Add(pricing.Total(items))
+}
+
+// insertBookingItemsTx records the items of a new booking
+func insertBookingItemsTx(tx *sql.Tx, bookingID int, items []BookingItem) error {
+	now := time.Now().UTC()
+	for _, item := range items {
+		_, err := tx.Exec(`
+			INSERT INTO booking_items (booking_id, kind, description, seat_id, concession_id, quantity, unit_amount, amount, currency, included, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, bookingID, item.Kind, item.Description, item.SeatID, item.ConcessionID, item.Quantity, item.UnitAmount, item.Amount, cinemaCurrency(), item.Included, now)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bookingItems lists the items of a booking in the order they were recorded
+func bookingItems(q queryer, bookingID int) ([]BookingItem, error) {
+	rows, err := q.Query(`
+		SELECT kind, description, seat_id, concession_id, quantity, unit_amount, amount, currency, included
+		FROM booking_items
+		WHERE booking_id = ?
+		ORDER BY id
+	`, bookingID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []BookingItem
+	for rows.Next() {
+		var item BookingItem
+		var currency string
+		err := rows.Scan(&item.Kind, &item.Description, &item.SeatID, &item.ConcessionID, &item.Quantity, &item.UnitAmount, &item.Amount, &currency, &item.Included)
+		if err != nil {
+			return nil, err
+		}
+		item.UnitAmount.Currency = currency
+		item.Amount.Currency = currency
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// backfillBookingItems itemises bookings made before booking items were
+// recorded. Seats still assigned to a booking share what was paid for
+// admission; bookings whose seats were released get a single admission line.
+func backfillBookingItems(tx *sql.Tx) error {
+	currency := cinemaCurrency()
+	if _, err := tx.Exec("UPDATE bookings SET currency = ? WHERE currency IS NULL", currency); err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(`
+		SELECT id, show_id, total_amount FROM bookings b
+		WHERE NOT EXISTS (SELECT 1 FROM booking_items i WHERE i.booking_id = b.id)
+	`)
+	if err != nil {
+		return err
+	}
+	type booking struct {
+		showID int
+		total  money.Money
+	}
+	bookings := make(map[int]booking)
+	for rows.Next() {
+		var id int
+		b := booking{total: money.New(0, currency)}
+		if err := rows.Scan(&id, &b.showID, &b.total); err != nil {
+			rows.Close()
+			return err
+		}
+		bookings[id] = b
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for bookingID, b := range bookings {
+		ordered, err := bookingConcessions(tx, bookingID)
+		if err != nil {
+			return err
+		}
+		extras := concessionItems(ordered)
+		admission := b.total.Sub(itemsTotal(extras))
+
+		var seatIDs []int
+		seatRows, err := tx.Query("SELECT id FROM seats WHERE booking_id = ? ORDER BY id", bookingID)
+		if err != nil {
+			return err
+		}
+		for seatRows.Next() {
+			var seatID int
+			if err := seatRows.Scan(&seatID); err != nil {
+				seatRows.Close()
+				return err
+			}
+			seatIDs = append(seatIDs, seatID)
+		}
+		seatRows.Close()
+		if err := seatRows.Err(); err != nil {
+			return err
+		}
+
+		var items []BookingItem
+		if len(seatIDs) > 0 {
+			// Seats were priced equally, so any odd cent goes on the first ones
+			for i, part := range admission.Split(len(seatIDs)) {
+				seat, err := seatItems(tx, b.showID, seatIDs[i:i+1], part)
+				if err != nil {
+					return err
+				}
+				items = append(items, seat...)
+			}
+		} else {
+			items = append(items, BookingItem{Kind: itemSeat, Description: "Admission", Quantity: 1, UnitAmount: admission, Amount: admission})
+		}
+		items = append(items, extras...)
+
+		if err := insertBookingItemsTx(tx, bookingID, items); err != nil {
+			return err
+		}
+	}
+	return nil
+}
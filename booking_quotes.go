@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"cinemabooking/concessions"
+	"cinemabooking/money"
+	"cinemabooking/pricing"
+
+	"github.com/gorilla/mux"
+)
+
+// BookingQuote is what a booking of seats would cost, item by item. The seats
+// must be free or held under the customer's hold token, but nothing is
+// reserved, so the seats or prices can change before the booking is made.
+type BookingQuote struct {
+	ShowID      int           `json:"show_id"`
+	SeatIDs     []int         `json:"seat_ids"`
+	Currency    string        `json:"currency"`
+	Items       []BookingItem `json:"items"`
+	TotalAmount money.Money   `json:"total_amount"`
+}
+
+// Quote the itemised total a booking of seats on a show would be charged
+func quoteBooking(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	showID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid show ID", http.StatusBadRequest)
+		return
+	}
+
+	var quoteRequest struct {
+		SeatIDs     []int              `json:"seat_ids"`
+		Concessions []concessions.Line `json:"concessions"`
+		HoldToken   string             `json:"hold_token"`
+		PriceOffer  string             `json:"price_offer"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&quoteRequest)
+	if err != nil {
+		log.Printf("Error decoding request: %v", err)
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	if len(quoteRequest.SeatIDs) == 0 {
+		writeSeatError(w, errNoSeats)
+		return
+	}
+
+	showPrice := noMoney()
+	var showStatus string
+	err = dbConn.QueryRow("SELECT price, status FROM shows WHERE id = ?", showID).Scan(&showPrice, &showStatus)
+	if err != nil {
+		log.Printf("Error fetching show price: %v", err)
+		http.Error(w, "Show not found", http.StatusNotFound)
+		return
+	}
+	if showStatus == "cancelled" {
+		http.Error(w, "Show has been cancelled", http.StatusConflict)
+		return
+	}
+	showPrice, err = currentShowPrice(dbConn, showID, showPrice)
+	if err != nil {
+		log.Printf("Error pricing show %d: %v", showID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	showPrice = honourPriceOffer(showID, quoteRequest.PriceOffer, showPrice)
+
+	// Seats someone else has booked or held can't be quoted
+	err = checkSeatsBookable(dbConn, showID, quoteRequest.SeatIDs, quoteRequest.HoldToken, false)
+	if err != nil {
+		writeSeatError(w, err)
+		return
+	}
+
+	ordered, err := priceConcessions(dbConn, quoteRequest.Concessions, false)
+	if err != nil {
+		writeConcessionError(w, err)
+		return
+	}
+
+	items, err := quoteItems(dbConn, showID, showPrice, quoteRequest.SeatIDs, ordered, pricing.Web)
+	if err != nil {
+		writeSeatError(w, err)
+		return
+	}
+
+	quote := BookingQuote{
+		ShowID:      showID,
+		SeatIDs:     quoteRequest.SeatIDs,
+		Currency:    cinemaCurrency(),
+		Items:       items,
+		TotalAmount: itemsTotal(items),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(quote)
+}
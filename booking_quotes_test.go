@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"cinemabooking/db"
+	"cinemabooking/money"
+	"cinemabooking/pricing"
+
+	"github.com/gorilla/mux"
+)
+
+// TestQuoteMatchesBooking tests that quoting seats and concessions gives the
+// same items and total as booking them, and that booked seats can't be quoted
+func TestQuoteMatchesBooking(t *testing.T) {
+	dbConn = db.GetTestDB(t)
+	defer dbConn.Close()
+	migrateDB()
+
+	pricingRules = pricing.Rules{
+		Fees:  []pricing.Fee{{Name: "Booking fee", Channel: pricing.Web, PerTicket: money.New(75, cinemaCurrency())}},
+		Taxes: []pricing.Tax{{Name: "VAT", Rate: 20, Inclusive: true}},
+	}
+	defer func() { pricingRules = pricing.Rules{} }()
+
+	result, err := dbConn.Exec(`
+		INSERT INTO movies (title, description, duration, rating, poster_url)
+		VALUES ('Quote Test', '', 120, 8.5, '')
+	`)
+	if err != nil {
+		t.Fatalf("Failed to insert test movie: %v", err)
+	}
+	movieID, _ := result.LastInsertId()
+
+	start := time.Now().UTC().Add(24 * time.Hour)
+	result, err = dbConn.Exec(`
+		INSERT INTO shows (movie_id, screen, start_time, end_time, price)
+		VALUES (?, 'Screen 1', ?, ?, ?)
+	`, movieID, start, start.Add(2*time.Hour), money.New(1000, cinemaCurrency()))
+	if err != nil {
+		t.Fatalf("Failed to insert test show: %v", err)
+	}
+	showID, _ := result.LastInsertId()
+
+	var seatIDs []int64
+	for i := 1; i <= 4; i++ {
+		result, err := dbConn.Exec(`
+			INSERT INTO seats (show_id, row_name, seat_number, status)
+			VALUES (?, 'A', ?, 'available')
+		`, showID, i)
+		if err != nil {
+			t.Fatalf("Failed to insert test seat %d: %v", i, err)
+		}
+		seatID, _ := result.LastInsertId()
+		seatIDs = append(seatIDs, seatID)
+	}
+
+	result, err = dbConn.Exec(`
+		INSERT INTO concessions (name, description, category, price, stock)
+		VALUES ('Popcorn', '', 'snack', 4.50, 10)
+	`)
+	if err != nil {
+		t.Fatalf("Failed to insert test concession: %v", err)
+	}
+	concessionID, _ := result.LastInsertId()
+
+	r := mux.NewRouter()
+	r.HandleFunc("/api/shows/{id}/quote", quoteBooking).Methods("POST")
+	r.HandleFunc("/api/bookings", createBooking).Methods("POST")
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	quotePath := fmt.Sprintf("/api/shows/%d/quote", showID)
+	order := fmt.Sprintf(`"seat_ids": [%d, %d], "concessions": [{"item_id": %d, "quantity": 2}]`, seatIDs[0], seatIDs[1], concessionID)
+
+	rec := post(quotePath, "{"+order+"}")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected quote status 200, got %d", rec.Code)
+	}
+	var quote BookingQuote
+	if err := json.NewDecoder(rec.Body).Decode(&quote); err != nil {
+		t.Fatalf("Failed to decode quote: %v", err)
+	}
+
+	rec = post("/api/bookings", fmt.Sprintf(`{"show_id": %d, "user_name": "Quote Test", %s}`, showID, order))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected booking status 200, got %d", rec.Code)
+	}
+	var booking Booking
+	if err := json.NewDecoder(rec.Body).Decode(&booking); err != nil {
+		t.Fatalf("Failed to decode booking: %v", err)
+	}
+	// Booked concessions would stop the next run clearing the bookings
+	defer dbConn.Exec("DELETE FROM booking_concessions WHERE booking_id = ?", booking.ID)
+
+	if !reflect.DeepEqual(quote.Items, booking.Items) {
+		t.Errorf("Expected booking items %+v to match quote %+v", booking.Items, quote.Items)
+	}
+	if quote.TotalAmount != booking.TotalAmount {
+		t.Errorf("Expected booking total %s to match quote %s", booking.TotalAmount.Format(), quote.TotalAmount.Format())
+	}
+
+	// The seats are booked now, so they can't be quoted again
+	rec = post(quotePath, "{"+order+"}")
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Expected quote status 409 for booked seats, got %d", rec.Code)
+	}
+
+	// Nor can seats someone else is holding
+	_, err = dbConn.Exec(`
+		UPDATE seats SET status = 'held', hold_token = 'someone-else', held_until = DATE_ADD(NOW(), INTERVAL 5 MINUTE)
+		WHERE id = ?
+	`, seatIDs[2])
+	if err != nil {
+		t.Fatalf("Failed to hold seat: %v", err)
+	}
+	rec = post(quotePath, fmt.Sprintf(`{"seat_ids": [%d]}`, seatIDs[2]))
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Expected quote status 409 for held seats, got %d", rec.Code)
+	}
+	rec = post(quotePath, fmt.Sprintf(`{"seat_ids": [%d], "hold_token": "someone-else"}`, seatIDs[2]))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected quote status 200 for seats held under the token, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"cinemabooking/auth"
+	"cinemabooking/bookingref"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/gorilla/mux"
+)
+
+// MySQL error number for a duplicate value in a unique index
+const errDuplicateEntry = 1062
+
+// Attempts at finding an unused booking reference
+const referenceAttempts = 5
+
+// insertBookingTx creates a confirmed booking of items, sold through a sales
+// channel, under a new reference and returns its ID and reference. The total
+// is the sum of the items. Guest bookings have no userID.
+func insertBookingTx(tx *sql.Tx, showID int, userID *int, userName, userEmail, channel string, items []BookingItem, bookingTime time.Time) (int, string, error) {
+	totalAmount := itemsTotal(items)
+	for attempt := 0; attempt < referenceAttempts; attempt++ {
+		reference, err := bookingref.New()
+		if err != nil {
+			return 0, "", err
+		}
+
+		result, err := tx.Exec(`
+			INSERT INTO bookings (reference, show_id, user_id, user_name, user_email, total_amount, currency, channel, booking_time, status)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, 'confirmed')
+		`, reference, showID, userID, userName, userEmail, totalAmount, cinemaCurrency(), channel, bookingTime)
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == errDuplicateEntry {
+			continue
+		}
+		if err != nil {
+			return 0, "", err
+		}
+
+		bookingID, err := result.LastInsertId()
+		if err != nil {
+			return 0, "", err
+		}
+		if err := insertBookingItemsTx(tx, int(bookingID), items); err != nil {
+			return 0, "", err
+		}
+		return int(bookingID), reference, nil
+	}
+	return 0, "", errors.New("no unused booking reference found")
+}
+
+// Signs guest booking access tokens, from BOOKING_ACCESS_KEY
+var (
+	accessKey     []byte
+	accessKeyOnce sync.Once
+)
+
+// bookingAccessKey returns the key guest access tokens are signed with. Without
+// BOOKING_ACCESS_KEY a random key is used, so tokens stop working on restart.
+func bookingAccessKey() []byte {
+	accessKeyOnce.Do(func() {
+		accessKey = []byte(os.Getenv("BOOKING_ACCESS_KEY"))
+		if len(accessKey) == 0 {
+			log.Printf("BOOKING_ACCESS_KEY is not set, guest booking links will expire on restart")
+			accessKey = make([]byte, 32)
+			if _, err := rand.Read(accessKey); err != nil {
+				log.Fatalf("Error generating booking access key: %v", err)
+			}
+		}
+	})
+	return accessKey
+}
+
+// authorizeBooking resolves the booking reference in the URL for a request
+// allowed to see it: box office staff and above, the logged-in customer who
+// made it or, for guest bookings, whoever holds the access token issued with
+// it or gives the email address it was made with. Everyone else gets 404, so
+// references can't be probed.
+func authorizeBooking(w http.ResponseWriter, r *http.Request) (int, bool) {
+	reference, err := bookingref.Parse(mux.Vars(r)["ref"])
+	if err != nil {
+		http.Error(w, "Booking not found", http.StatusNotFound)
+		return 0, false
+	}
+
+	var bookingID int
+	var ownerID sql.NullInt64
+	var userEmail string
+	err = dbConn.QueryRow("SELECT id, user_id, COALESCE(user_email, '') FROM bookings WHERE reference = ?", reference).Scan(&bookingID, &ownerID, &userEmail)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Booking not found", http.StatusNotFound)
+		return 0, false
+	}
+	if err != nil {
+		log.Printf("Error fetching booking %s: %v", reference, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return 0, false
+	}
+
+	user, err := currentUser(r)
+	if err != nil {
+		log.Printf("Error fetching session: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return 0, false
+	}
+
+	if isAdminRequest(r) || (user != nil && user.Role.Can(auth.PermViewBookings)) {
+		return bookingID, true
+	}
+
+	if ownerID.Valid {
+		if user != nil && int64(user.ID) == ownerID.Int64 {
+			return bookingID, true
+		}
+	} else if auth.CheckBookingToken(bookingAccessKey(), reference, r.URL.Query().Get("token")) {
+		return bookingID, true
+	} else if guestEmailMatches(r.Header.Get("X-Booking-Email"), userEmail) {
+		// Guests who booked before access tokens, or lost the link, can
+		// still open their booking with the email address. It comes in a
+		// header so it stays out of URLs and access logs
+		return bookingID, true
+	}
+
+	log.Printf("Refused access to booking %s", reference)
+	http.Error(w, "Booking not found", http.StatusNotFound)
+	return 0, false
+}
+
+// guestEmailMatches reports whether the email address given for a guest
+// booking is the one it was made with
+func guestEmailMatches(given, bookedWith string) bool {
+	given = strings.ToLower(strings.TrimSpace(given))
+	bookedWith = strings.ToLower(strings.TrimSpace(bookedWith))
+	return bookedWith != "" && subtle.ConstantTimeCompare([]byte(given), []byte(bookedWith)) == 1
+}
+
+// bookingLink is the confirmation page of a booking, with the access token
+// guests need to open it
+func bookingLink(reference string, guest bool) string {
+	link := publicBaseURL() + "/booking/" + reference
+	if guest {
+		link += "?token=" + auth.BookingToken(bookingAccessKey(), reference)
+	}
+	return link
+}
+
+// assignBookingReferences gives every existing booking a reference
+func assignBookingReferences(tx *sql.Tx) error {
+	rows, err := tx.Query("SELECT id FROM bookings WHERE reference IS NULL")
+	if err != nil {
+		return err
+	}
+
+	var bookingIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		bookingIDs = append(bookingIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range bookingIDs {
+		for attempt := 0; ; attempt++ {
+			reference, err := bookingref.New()
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec("UPDATE bookings SET reference = ? WHERE id = ?", reference, id)
+			var mysqlErr *mysql.MySQLError
+			if errors.As(err, &mysqlErr) && mysqlErr.Number == errDuplicateEntry && attempt < referenceAttempts {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			break
+		}
+	}
+	log.Printf("Assigned references to %d bookings", len(bookingIDs))
+	return nil
+}
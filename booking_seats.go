@@ -0,0 +1,104 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"cinemabooking/seating"
+)
+
+// Reasons a set of seats can't be booked
+var (
+	errNoSeats         = errors.New("no seats selected")
+	errSeatNotFound    = errors.New("seat not found")
+	errSeatUnavailable = errors.New("some seats are not available")
+)
+
+// errBookingNotConfirmed is returned for bookings that were cancelled or exchanged
+var errBookingNotConfirmed = errors.New("booking is not confirmed")
+
+// reserveSeatsTx locks the requested seats of a show and checks they can be
+// booked: each must be available (or held under holdToken) and together they
+// must pass the show's seating rules
+func reserveSeatsTx(tx *sql.Tx, showID int, seatIDs []int, holdToken string, enforceSeatGaps bool) error {
+	if len(seatIDs) == 0 {
+		return errNoSeats
+	}
+
+	err := releaseExpiredHolds(tx, showID)
+	if err != nil {
+		return err
+	}
+
+	err = checkSeatsBookable(tx, showID, seatIDs, holdToken, true)
+	if err != nil {
+		return err
+	}
+
+	return checkSeatRules(tx, showID, seatIDs, holdToken, seatRulesForShow(enforceSeatGaps))
+}
+
+// checkSeatsBookable checks each seat is available or held under holdToken,
+// locking the seats when lock is set. Holds that have run out count as
+// available, so the check needs no writes.
+func checkSeatsBookable(q queryer, showID int, seatIDs []int, holdToken string, lock bool) error {
+	query := `
+		SELECT CASE WHEN status = 'held' AND held_until < NOW() THEN 'available' ELSE status END,
+			COALESCE(hold_token, '')
+		FROM seats WHERE id = ? AND show_id = ?`
+	if lock {
+		query += " FOR UPDATE"
+	}
+
+	for _, seatID := range seatIDs {
+		var status, seatHoldToken string
+		err := q.QueryRow(query, seatID, showID).Scan(&status, &seatHoldToken)
+		if err == sql.ErrNoRows {
+			log.Printf("Seat %d not found for show %d", seatID, showID)
+			return errSeatNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if !seatBookable(status, seatHoldToken, holdToken) {
+			log.Printf("Seat %d is not available (status: %s)", seatID, status)
+			return errSeatUnavailable
+		}
+	}
+	return nil
+}
+
+// assignSeatsTx marks seats as booked by a booking
+func assignSeatsTx(tx *sql.Tx, bookingID int, seatIDs []int) error {
+	for _, seatID := range seatIDs {
+		_, err := tx.Exec(`
+			UPDATE seats SET status = 'booked', booking_id = ?, hold_token = NULL, held_until = NULL, admitted_at = NULL WHERE id = ?
+		`, bookingID, seatID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeSeatError reports an error from reserveSeatsTx to the client
+func writeSeatError(w http.ResponseWriter, err error) {
+	var violation *seating.Violation
+	switch {
+	case errors.Is(err, errNoSeats):
+		http.Error(w, "No seats selected", http.StatusBadRequest)
+	case errors.Is(err, errSeatNotFound):
+		http.Error(w, "Seat not found", http.StatusNotFound)
+	case errors.Is(err, errSeatUnavailable):
+		http.Error(w, "Some seats are not available", http.StatusConflict)
+	case errors.As(err, &violation):
+		log.Printf("Seat selection rejected by rule %s: %v", violation.Rule, violation)
+		http.Error(w, violation.Error(), http.StatusConflict)
+	default:
+		log.Printf("Error reserving seats: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,56 @@
+// Package bookingref generates and checks the reference codes customers use
+// to look up their bookings.
+//
+// A reference is 7 random Crockford base32 symbols followed by a Luhn mod 32
+// check symbol, so typos are caught before the database is asked.
+package bookingref
+
+import (
+	"errors"
+	"strings"
+
+	"cinemabooking/crockford"
+)
+
+// Length of a reference, including the check symbol
+const Length = 8
+
+// ErrInvalid is returned for strings that aren't a well-formed reference.
+var ErrInvalid = errors.New("bookingref: invalid reference")
+
+// New returns a random reference.
+func New() (string, error) {
+	code, err := crockford.Random(Length - 1)
+	if err != nil {
+		return "", err
+	}
+	return string(append(code, checkSymbol(code))), nil
+}
+
+// Parse normalises a reference as typed by a customer (any case, with
+// optional spaces or dashes, O for 0 and I or L for 1) and verifies its check
+// symbol.
+func Parse(s string) (string, error) {
+	s, ok := crockford.Normalise(s)
+	if !ok || len(s) != Length {
+		return "", ErrInvalid
+	}
+	if checkSymbol([]byte(s[:Length-1])) != s[Length-1] {
+		return "", ErrInvalid
+	}
+	return s, nil
+}
+
+// checkSymbol computes the Luhn mod 32 check symbol of a code, which catches
+// any single mistyped symbol and most swapped neighbours
+func checkSymbol(code []byte) byte {
+	n := len(crockford.Alphabet)
+	factor := 2
+	sum := 0
+	for i := len(code) - 1; i >= 0; i-- {
+		addend := factor * strings.IndexByte(crockford.Alphabet, code[i])
+		sum += addend/n + addend%n
+		factor = 3 - factor
+	}
+	return crockford.Alphabet[(n-sum%n)%n]
+}
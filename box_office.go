@@ -0,0 +1,528 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"cinemabooking/boxoffice"
+	"cinemabooking/money"
+	"cinemabooking/pricing"
+
+	"github.com/gorilla/mux"
+)
+
+// Till is a staff member's cash drawer for one shift
+type Till struct {
+	ID           int              `json:"id"`
+	UserID       int              `json:"user_id"`
+	StaffName    string           `json:"staff_name"`
+	OpeningFloat money.Money      `json:"opening_float"`
+	OpenedAt     time.Time        `json:"opened_at"`
+	ClosedAt     *time.Time       `json:"closed_at,omitempty"`
+	Notes        string           `json:"notes,omitempty"`
+	Totals       boxoffice.Totals `json:"totals"`
+	// Only set once the till is closed and counted
+	Reconciliation *boxoffice.Reconciliation `json:"reconciliation,omitempty"`
+}
+
+// BoxOfficeSale is a booking sold at the counter
+type BoxOfficeSale struct {
+	Booking       Booking                 `json:"booking"`
+	TillID        int                     `json:"till_id"`
+	PaymentMethod boxoffice.PaymentMethod `json:"payment_method"`
+	// What was taken by the payment method, after any voucher
+	AmountDue money.Money  `json:"amount_due"`
+	Tendered  *money.Money `json:"tendered,omitempty"`
+	Change    *money.Money `json:"change,omitempty"`
+}
+
+// staffUser returns the logged-in staff member. Tills belong to a person, so
+// the admin key alone can't sell at the counter.
+func staffUser(w http.ResponseWriter, r *http.Request) (*User, bool) {
+	user, err := currentUser(r)
+	if err != nil {
+		log.Printf("Error fetching session: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return nil, false
+	}
+	if user == nil {
+		http.Error(w, "Box office sales need a staff login", http.StatusForbidden)
+		return nil, false
+	}
+	return user, true
+}
+
+// openTillID returns the staff member's open till, or sql.ErrNoRows
+func openTillID(q queryer, userID int) (int, error) {
+	var tillID int
+	err := q.QueryRow("SELECT id FROM tills WHERE user_id = ? AND closed_at IS NULL", userID).Scan(&tillID)
+	return tillID, err
+}
+
+// Open a till for the logged-in staff member with the cash float in the drawer
+func openTill(w http.ResponseWriter, r *http.Request) {
+	user, ok := staffUser(w, r)
+	if !ok {
+		return
+	}
+
+	var openRequest struct {
+		OpeningFloat money.Money `json:"opening_float"`
+	}
+	openRequest.OpeningFloat = noMoney()
+	err := json.NewDecoder(r.Body).Decode(&openRequest)
+	if err != nil && err != io.EOF {
+		log.Printf("Error decoding request: %v", err)
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	if openRequest.OpeningFloat.IsNegative() {
+		http.Error(w, "Opening float must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := dbConn.Begin()
+	if err != nil {
+		log.Printf("Error beginning transaction: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// Locking the staff member stops two tills being opened at once
+	var lockedID int
+	err = tx.QueryRow("SELECT id FROM users WHERE id = ? FOR UPDATE", user.ID).Scan(&lockedID)
+	if err != nil {
+		log.Printf("Error locking user %d: %v", user.ID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	_, err = openTillID(tx, user.ID)
+	if err == nil {
+		http.Error(w, "You already have an open till", http.StatusConflict)
+		return
+	}
+	if err != sql.ErrNoRows {
+		log.Printf("Error fetching till: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	openingFloat := openRequest.OpeningFloat
+	openedAt := time.Now().UTC()
+	result, err := tx.Exec(`
+		INSERT INTO tills (user_id, opening_float, opened_at) VALUES (?, ?, ?)
+	`, user.ID, openingFloat, openedAt)
+	if err != nil {
+		log.Printf("Error opening till: %v", err)
+		http.Error(w, "Error opening till", http.StatusInternalServerError)
+		return
+	}
+	tillID, err := result.LastInsertId()
+	if err != nil {
+		log.Printf("Error opening till: %v", err)
+		http.Error(w, "Error opening till", http.StatusInternalServerError)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("%s opened till %d with a float of %s", user.Email, tillID, openingFloat)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(Till{
+		ID:           int(tillID),
+		UserID:       user.ID,
+		StaffName:    user.Name,
+		OpeningFloat: openingFloat,
+		OpenedAt:     inCinemaTime(openedAt),
+		Totals:       boxoffice.NewTotals(openingFloat.Currency),
+	})
+}
+
+// Show the logged-in staff member's open till with its running totals
+func getCurrentTill(w http.ResponseWriter, r *http.Request) {
+	user, ok := staffUser(w, r)
+	if !ok {
+		return
+	}
+
+	tillID, err := openTillID(dbConn, user.ID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "No open till", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching till: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	writeTill(w, tillID)
+}
+
+// Show any till, with the reconciliation report once it is closed
+func getTill(w http.ResponseWriter, r *http.Request) {
+	tillID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid till ID", http.StatusBadRequest)
+		return
+	}
+	writeTill(w, tillID)
+}
+
+// Close the logged-in staff member's till with the cash counted in the
+// drawer, and report how it compares with the takings
+func closeTill(w http.ResponseWriter, r *http.Request) {
+	user, ok := staffUser(w, r)
+	if !ok {
+		return
+	}
+
+	var closeRequest struct {
+		CountedCash *money.Money `json:"counted_cash"`
+		Notes       string       `json:"notes"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&closeRequest)
+	if err != nil {
+		log.Printf("Error decoding request: %v", err)
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	if closeRequest.CountedCash == nil || closeRequest.CountedCash.IsNegative() {
+		http.Error(w, "Enter the cash counted in the till", http.StatusBadRequest)
+		return
+	}
+	countedCash := money.New(closeRequest.CountedCash.Cents, cinemaCurrency())
+
+	result, err := dbConn.Exec(`
+		UPDATE tills SET closed_at = ?, counted_cash = ?, notes = ?
+		WHERE user_id = ? AND closed_at IS NULL
+	`, time.Now().UTC(), countedCash, closeRequest.Notes, user.ID)
+	if err != nil {
+		log.Printf("Error closing till: %v", err)
+		http.Error(w, "Error closing till", http.StatusInternalServerError)
+		return
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		http.Error(w, "No open till", http.StatusNotFound)
+		return
+	}
+
+	var tillID int
+	err = dbConn.QueryRow("SELECT id FROM tills WHERE user_id = ? ORDER BY closed_at DESC, id DESC LIMIT 1", user.ID).Scan(&tillID)
+	if err != nil {
+		log.Printf("Error fetching till: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("%s closed till %d with %s counted", user.Email, tillID, countedCash)
+	writeTill(w, tillID)
+}
+
+// writeTill loads a till with its totals and writes it as JSON
+func writeTill(w http.ResponseWriter, tillID int) {
+	till, err := loadTill(dbConn, tillID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Till not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching till %d: %v", tillID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(till)
+}
+
+// loadTill fetches a till and adds up the sales and refunds taken on it
+func loadTill(q queryer, tillID int) (Till, error) {
+	var till Till
+	var closedAt sql.NullTime
+	till.OpeningFloat = noMoney()
+	// Closed tills always have a count
+	countedCash := noMoney()
+	err := q.QueryRow(`
+		SELECT t.id, t.user_id, COALESCE(u.name, u.email), t.opening_float, t.opened_at, t.closed_at, t.counted_cash, COALESCE(t.notes, '')
+		FROM tills t
+		JOIN users u ON u.id = t.user_id
+		WHERE t.id = ?
+	`, tillID).Scan(&till.ID, &till.UserID, &till.StaffName, &till.OpeningFloat, &till.OpenedAt, &closedAt, &countedCash, &till.Notes)
+	if err != nil {
+		return till, err
+	}
+	till.OpenedAt = inCinemaTime(till.OpenedAt)
+
+	// Sales stay in the takings when they are refunded later; the refund is
+	// counted separately. The part of a sale paid by voucher is counted as
+	// voucher takings whatever paid the rest.
+	till.Totals = boxoffice.NewTotals(till.OpeningFloat.Currency)
+	rows, err := q.Query(`
+		SELECT payment_method, total_amount, voucher_amount FROM bookings WHERE till_id = ?
+	`, tillID)
+	if err != nil {
+		return till, err
+	}
+	for rows.Next() {
+		var method boxoffice.PaymentMethod
+		amount, voucherAmount := noMoney(), noMoney()
+		if err := rows.Scan(&method, &amount, &voucherAmount); err != nil {
+			rows.Close()
+			return till, err
+		}
+		till.Totals.AddSale(method, amount.Sub(voucherAmount))
+		if voucherAmount.IsPositive() {
+			till.Totals.AddPart(boxoffice.Voucher, voucherAmount)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return till, err
+	}
+
+	rows, err = q.Query("SELECT method, amount FROM refunds WHERE till_id = ?", tillID)
+	if err != nil {
+		return till, err
+	}
+	for rows.Next() {
+		var method boxoffice.PaymentMethod
+		amount := noMoney()
+		if err := rows.Scan(&method, &amount); err != nil {
+			rows.Close()
+			return till, err
+		}
+		till.Totals.AddRefund(method, amount)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return till, err
+	}
+
+	if closedAt.Valid {
+		closed := inCinemaTime(closedAt.Time)
+		till.ClosedAt = &closed
+		report := boxoffice.Reconcile(till.OpeningFloat, till.Totals, countedCash)
+		till.Reconciliation = &report
+	}
+	return till, nil
+}
+
+// Sell seats to a walk-in customer on the staff member's open till
+func createBoxOfficeBooking(w http.ResponseWriter, r *http.Request) {
+	user, ok := staffUser(w, r)
+	if !ok {
+		return
+	}
+
+	var saleRequest struct {
+		ShowID        int         `json:"show_id"`
+		SeatIDs       []int       `json:"seat_ids"`
+		PaymentMethod string      `json:"payment_method"`
+		Tendered      money.Money `json:"tendered"`
+		CustomerName  string      `json:"customer_name"`
+		CustomerEmail string      `json:"customer_email"`
+		// A gift voucher paying all (for the voucher method) or part of the total
+		VoucherCode string `json:"voucher_code"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&saleRequest)
+	if err != nil {
+		log.Printf("Error decoding request: %v", err)
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	method, err := boxoffice.ParsePaymentMethod(saleRequest.PaymentMethod)
+	if err != nil {
+		http.Error(w, "Payment method must be cash, card or voucher", http.StatusBadRequest)
+		return
+	}
+	if method == boxoffice.Voucher && saleRequest.VoucherCode == "" {
+		http.Error(w, "Enter the voucher code", http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("Box office sale by %s: Show ID=%d, Seats=%v, %s", user.Email, saleRequest.ShowID, saleRequest.SeatIDs, method)
+
+	sale := BoxOfficeSale{PaymentMethod: method}
+
+	tx, err := dbConn.Begin()
+	if err != nil {
+		log.Printf("Error beginning transaction: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow("SELECT id FROM tills WHERE user_id = ? AND closed_at IS NULL FOR UPDATE", user.ID).Scan(&sale.TillID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Open a till before selling tickets", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching till: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	// Read the show under a shared lock so it can't be cancelled mid-sale
+	showPrice := noMoney()
+	var enforceSeatGaps bool
+	var showStatus string
+	err = tx.QueryRow("SELECT price, enforce_seat_gaps, status FROM shows WHERE id = ? LOCK IN SHARE MODE", saleRequest.ShowID).Scan(&showPrice, &enforceSeatGaps, &showStatus)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Show not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching show price: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if showStatus == "cancelled" {
+		http.Error(w, "Show has been cancelled", http.StatusConflict)
+		return
+	}
+	showPrice, err = currentShowPrice(tx, saleRequest.ShowID, showPrice)
+	if err != nil {
+		log.Printf("Error pricing show %d: %v", saleRequest.ShowID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	err = reserveSeatsTx(tx, saleRequest.ShowID, saleRequest.SeatIDs, "", enforceSeatGaps)
+	if err != nil {
+		writeSeatError(w, err)
+		return
+	}
+
+	items, err := quoteItems(tx, saleRequest.ShowID, showPrice, saleRequest.SeatIDs, nil, pricing.BoxOffice)
+	if err != nil {
+		log.Printf("Error pricing booking: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	totalAmount := itemsTotal(items)
+
+	// Walk-in customers don't have accounts; the booking is a guest booking
+	bookingTime := time.Now().UTC()
+	bookingID, reference, err := insertBookingTx(tx, saleRequest.ShowID, nil, saleRequest.CustomerName, saleRequest.CustomerEmail, pricing.BoxOffice, items, bookingTime)
+	if err != nil {
+		log.Printf("Error creating booking: %v", err)
+		http.Error(w, "Error creating booking", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = tx.Exec(`
+		UPDATE bookings SET sold_by = ?, payment_method = ?, till_id = ?
+		WHERE id = ?
+	`, user.ID, method, sale.TillID, bookingID)
+	if err != nil {
+		log.Printf("Error recording sale: %v", err)
+		http.Error(w, "Error creating booking", http.StatusInternalServerError)
+		return
+	}
+
+	voucherAmount := noMoney()
+	if saleRequest.VoucherCode != "" {
+		voucherAmount, err = redeemVoucherTx(tx, saleRequest.VoucherCode, bookingID, totalAmount)
+		if err != nil {
+			writeVoucherError(w, err)
+			return
+		}
+	}
+	sale.AmountDue = totalAmount.Sub(voucherAmount)
+	if method == boxoffice.Voucher && sale.AmountDue.IsPositive() {
+		http.Error(w, "Voucher balance doesn't cover the total; take the rest by cash or card", http.StatusConflict)
+		return
+	}
+	if method == boxoffice.Cash && saleRequest.Tendered.IsPositive() {
+		change := saleRequest.Tendered.Sub(sale.AmountDue)
+		if change.IsNegative() {
+			http.Error(w, "Cash tendered is less than the amount due", http.StatusBadRequest)
+			return
+		}
+		sale.Tendered = &saleRequest.Tendered
+		sale.Change = &change
+	}
+
+	err = assignSeatsTx(tx, bookingID, saleRequest.SeatIDs)
+	if err != nil {
+		log.Printf("Error updating seats: %v", err)
+		http.Error(w, "Error updating seat status", http.StatusInternalServerError)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Box office booking created. ID: %d, reference: %s, till: %d", bookingID, reference, sale.TillID)
+
+	sendBookingConfirmation(bookingID)
+
+	sale.Booking = Booking{
+		ID:            bookingID,
+		Reference:     reference,
+		ShowID:        saleRequest.ShowID,
+		UserName:      saleRequest.CustomerName,
+		UserEmail:     saleRequest.CustomerEmail,
+		SeatIDs:       saleRequest.SeatIDs,
+		TotalAmount:   totalAmount,
+		Currency:      cinemaCurrency(),
+		BookingTime:   inCinemaTime(bookingTime),
+		Status:        "confirmed",
+		Items:         items,
+		VoucherAmount: voucherAmount,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sale)
+}
+
+// recordTillRefundTx puts the refund of a counter sale on the refunding staff
+// member's open till, paid back the way the customer paid. Online bookings
+// and staff without an open till are refunded outside the till.
+func recordTillRefundTx(tx *sql.Tx, bookingID int, user *User) error {
+	if user == nil {
+		return nil
+	}
+
+	var channel string
+	var method sql.NullString
+	err := tx.QueryRow("SELECT channel, payment_method FROM bookings WHERE id = ?", bookingID).Scan(&channel, &method)
+	if err != nil {
+		return err
+	}
+	if channel != "box_office" || !method.Valid {
+		return nil
+	}
+
+	tillID, err := openTillID(tx, user.ID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE refunds SET till_id = ?, method = ?, status = 'paid'
+		WHERE booking_id = ? AND till_id IS NULL
+	`, tillID, method.String, bookingID)
+	return err
+}
@@ -0,0 +1,105 @@
+// Package boxoffice handles counter sales: how they are paid for and
+// reconciling a till at the end of a shift.
+package boxoffice
+
+import (
+	"errors"
+
+	"cinemabooking/money"
+)
+
+// PaymentMethod is how a counter sale was paid.
+type PaymentMethod string
+
+// Payment methods taken at the counter
+const (
+	Cash    PaymentMethod = "cash"
+	Card    PaymentMethod = "card"
+	Voucher PaymentMethod = "voucher"
+)
+
+// ErrUnknownPaymentMethod is returned for unsupported payment methods.
+var ErrUnknownPaymentMethod = errors.New("boxoffice: unknown payment method")
+
+// ParsePaymentMethod checks a payment method name.
+func ParsePaymentMethod(name string) (PaymentMethod, error) {
+	switch m := PaymentMethod(name); m {
+	case Cash, Card, Voucher:
+		return m, nil
+	}
+	return "", ErrUnknownPaymentMethod
+}
+
+// Totals are the takings of a till by payment method, in the till's
+// currency. Refunds are positive amounts paid back out.
+type Totals struct {
+	Sales    map[PaymentMethod]money.Money `json:"sales"`
+	Refunds  map[PaymentMethod]money.Money `json:"refunds"`
+	Count    int                           `json:"sales_count"`
+	Currency string                        `json:"currency"`
+}
+
+// NewTotals returns empty totals in a currency.
+func NewTotals(currency string) Totals {
+	return Totals{Sales: map[PaymentMethod]money.Money{}, Refunds: map[PaymentMethod]money.Money{}, Currency: currency}
+}
+
+// AddSale records a sale.
+func (t *Totals) AddSale(method PaymentMethod, amount money.Money) {
+	t.Sales[method] = t.amount(t.Sales[method]).Add(amount)
+	t.Count++
+}
+
+// AddPart records part of a sale already counted that was paid another way.
+func (t *Totals) AddPart(method PaymentMethod, amount money.Money) {
+	t.Sales[method] = t.amount(t.Sales[method]).Add(amount)
+}
+
+// AddRefund records money paid back.
+func (t *Totals) AddRefund(method PaymentMethod, amount money.Money) {
+	t.Refunds[method] = t.amount(t.Refunds[method]).Add(amount)
+}
+
+// Net is what the till took overall, after refunds.
+func (t Totals) Net() money.Money {
+	net := money.New(0, t.Currency)
+	for _, amount := range t.Sales {
+		net = net.Add(amount)
+	}
+	for _, amount := range t.Refunds {
+		net = net.Sub(amount)
+	}
+	return net
+}
+
+// amount puts a total with nothing in it yet in the till's currency
+func (t Totals) amount(m money.Money) money.Money {
+	if m.Currency == "" {
+		m.Currency = t.Currency
+	}
+	return m
+}
+
+// Reconciliation compares the cash counted at the end of a shift with what
+// the till should hold.
+type Reconciliation struct {
+	OpeningFloat money.Money `json:"opening_float"`
+	Totals       Totals      `json:"totals"`
+	ExpectedCash money.Money `json:"expected_cash"`
+	CountedCash  money.Money `json:"counted_cash"`
+	// Positive when there is more cash than expected, negative when short
+	Variance money.Money `json:"variance"`
+}
+
+// Reconcile works out the expected cash (float plus cash sales less cash
+// refunds) and the variance from what was counted.
+func Reconcile(openingFloat money.Money, totals Totals, countedCash money.Money) Reconciliation {
+	expected := openingFloat.Add(totals.Sales[Cash]).Sub(totals.Refunds[Cash])
+	return Reconciliation{
+		OpeningFloat: openingFloat,
+		Totals:       totals,
+		ExpectedCash: expected,
+		CountedCash:  countedCash,
+		Variance:     countedCash.Sub(expected),
+	}
+}
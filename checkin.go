@@ -0,0 +1,186 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"cinemabooking/tickets"
+)
+
+// Defaults for CHECKIN_OPENS_MINUTES and CHECKIN_CLOSES_MINUTES
+const (
+	defaultCheckinOpens  = 60 * time.Minute
+	defaultCheckinCloses = 30 * time.Minute
+)
+
+// Check-in outcomes reported to the scanner
+const (
+	checkinAdmitted        = "admitted"
+	checkinAlreadyAdmitted = "already_admitted"
+	checkinInvalid         = "invalid_ticket"
+	checkinNotConfirmed    = "not_confirmed"
+	checkinTooEarly        = "too_early"
+	checkinTooLate         = "too_late"
+)
+
+// CheckinResult tells the usher whether to let the customer in
+type CheckinResult struct {
+	Status     string     `json:"status"`
+	Message    string     `json:"message"`
+	BookingID  int        `json:"booking_id,omitempty"`
+	Reference  string     `json:"reference,omitempty"`
+	ShowID     int        `json:"show_id,omitempty"`
+	Seats      []string   `json:"seats,omitempty"`
+	StartTime  *time.Time `json:"start_time,omitempty"`
+	AdmittedAt *time.Time `json:"admitted_at,omitempty"`
+}
+
+// checkinWindow is when tickets can be scanned relative to the show start,
+// from CHECKIN_OPENS_MINUTES before until CHECKIN_CLOSES_MINUTES after
+func checkinWindow() tickets.Window {
+	window := tickets.Window{Opens: defaultCheckinOpens, Closes: defaultCheckinCloses}
+	if minutes, err := strconv.Atoi(os.Getenv("CHECKIN_OPENS_MINUTES")); err == nil && minutes >= 0 {
+		window.Opens = time.Duration(minutes) * time.Minute
+	}
+	if minutes, err := strconv.Atoi(os.Getenv("CHECKIN_CLOSES_MINUTES")); err == nil && minutes >= 0 {
+		window.Closes = time.Duration(minutes) * time.Minute
+	}
+	return window
+}
+
+// Check in a scanned ticket, admitting its seats once
+func checkIn(w http.ResponseWriter, r *http.Request) {
+	var checkinRequest struct {
+		Ticket string `json:"ticket"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&checkinRequest)
+	if err != nil {
+		log.Printf("Error decoding request: %v", err)
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	key := ticketKey()
+	if len(key) == 0 {
+		log.Printf("TICKET_SIGNING_KEY is not set, can't check tickets")
+		http.Error(w, "Tickets are not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	payload, err := tickets.Verify(checkinRequest.Ticket, key)
+	if err != nil {
+		log.Printf("Rejected invalid ticket at check-in")
+		writeCheckinResult(w, http.StatusBadRequest, CheckinResult{Status: checkinInvalid, Message: "Ticket is not valid"})
+		return
+	}
+
+	result := CheckinResult{BookingID: payload.BookingID, Reference: payload.Reference, ShowID: payload.ShowID, Seats: payload.Seats}
+
+	tx, err := dbConn.Begin()
+	if err != nil {
+		log.Printf("Error beginning transaction: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var status string
+	var startTime time.Time
+	err = tx.QueryRow(`
+		SELECT b.status, s.start_time
+		FROM bookings b
+		JOIN shows s ON s.id = b.show_id
+		WHERE b.id = ? AND b.show_id = ?
+		FOR UPDATE
+	`, payload.BookingID, payload.ShowID).Scan(&status, &startTime)
+	if err == sql.ErrNoRows {
+		writeCheckinResult(w, http.StatusNotFound, CheckinResult{Status: checkinInvalid, Message: "Booking not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching booking %d for check-in: %v", payload.BookingID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	startTime = inCinemaTime(startTime)
+	result.StartTime = &startTime
+
+	if status != "confirmed" {
+		result.Status = checkinNotConfirmed
+		result.Message = "Booking is " + status
+		writeCheckinResult(w, http.StatusConflict, result)
+		return
+	}
+
+	// Seats admitted by an earlier scan mean the ticket was already used
+	var admittedAt sql.NullTime
+	err = tx.QueryRow("SELECT MIN(admitted_at) FROM seats WHERE booking_id = ?", payload.BookingID).Scan(&admittedAt)
+	if err != nil {
+		log.Printf("Error checking admission for booking %d: %v", payload.BookingID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if admittedAt.Valid {
+		at := inCinemaTime(admittedAt.Time)
+		result.Status = checkinAlreadyAdmitted
+		result.Message = "Ticket was already scanned at " + at.Format("15:04")
+		result.AdmittedAt = &at
+		writeCheckinResult(w, http.StatusConflict, result)
+		return
+	}
+
+	now := time.Now().UTC()
+	switch checkinWindow().Check(startTime, now) {
+	case tickets.ErrTooEarly:
+		result.Status = checkinTooEarly
+		result.Message = "Check-in for this show has not opened yet"
+		writeCheckinResult(w, http.StatusConflict, result)
+		return
+	case tickets.ErrTooLate:
+		result.Status = checkinTooLate
+		result.Message = "Check-in for this show has closed"
+		writeCheckinResult(w, http.StatusConflict, result)
+		return
+	}
+
+	_, err = tx.Exec("UPDATE seats SET admitted_at = ? WHERE booking_id = ?", now, payload.BookingID)
+	if err != nil {
+		log.Printf("Error admitting booking %d: %v", payload.BookingID, err)
+		http.Error(w, "Error admitting seats", http.StatusInternalServerError)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Admitted booking %d to show %d", payload.BookingID, payload.ShowID)
+
+	at := inCinemaTime(now)
+	result.Status = checkinAdmitted
+	result.Message = fmt.Sprintf("Admit %d: %s", len(payload.Seats), strings.Join(payload.Seats, ", "))
+	result.AdmittedAt = &at
+	writeCheckinResult(w, http.StatusOK, result)
+}
+
+func writeCheckinResult(w http.ResponseWriter, status int, result CheckinResult) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
+
+func serveCheckin(w http.ResponseWriter, r *http.Request) {
+	tmpl := template.Must(template.ParseFiles("templates/checkin.html"))
+	tmpl.Execute(w, nil)
+}
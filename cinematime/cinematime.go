@@ -0,0 +1,36 @@
+// Package cinematime converts between calendar days in the cinema's time
+// zone and the instants used to query show times.
+package cinematime
+
+import (
+	"errors"
+	"time"
+)
+
+// DateLayout is the format of the dates accepted by the API.
+const DateLayout = "2006-01-02"
+
+// ErrInvalidDate is returned for dates not in DateLayout.
+var ErrInvalidDate = errors.New("date must be in YYYY-MM-DD format")
+
+// LoadLocation returns the named IANA time zone, or the server's local zone
+// when name is empty.
+func LoadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(name)
+}
+
+// DayBounds returns the start of the given day and the start of the next one
+// in loc. Days are not always 24 hours long: across a DST change they are 23
+// or 25, which is why the end is computed from the calendar rather than by
+// adding a fixed duration.
+func DayBounds(date string, loc *time.Location) (time.Time, time.Time, error) {
+	day, err := time.ParseInLocation(DateLayout, date, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, ErrInvalidDate
+	}
+	next := time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, loc)
+	return day, next, nil
+}
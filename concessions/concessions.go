@@ -0,0 +1,97 @@
+// Package concessions checks food and drink orders added to bookings and
+// issues the codes customers collect them with.
+package concessions
+
+import (
+	"crypto/rand"
+	"errors"
+	"sort"
+	"strings"
+)
+
+// Largest quantity of one item on a booking
+const MaxQuantity = 20
+
+// Pickup codes avoid symbols that are easily confused when read out
+const pickupAlphabet = "ACDEFGHJKMNPQRTUVWXY34679"
+
+// Length of a pickup code
+const PickupCodeLength = 6
+
+// Errors returned by Normalize
+var (
+	ErrInvalidItem     = errors.New("concessions: invalid item")
+	ErrInvalidQuantity = errors.New("concessions: quantity must be between 1 and 20")
+)
+
+// ErrInvalidPickupCode is returned for strings that can't be a pickup code.
+var ErrInvalidPickupCode = errors.New("concessions: invalid pickup code")
+
+// Line is a quantity of one catalogue item.
+type Line struct {
+	ItemID   int `json:"item_id"`
+	Quantity int `json:"quantity"`
+}
+
+// Normalize merges lines for the same item and orders them by item, so items
+// are always locked in the same order. Quantities must be positive and no
+// item may be ordered more than MaxQuantity times.
+func Normalize(lines []Line) ([]Line, error) {
+	quantities := make(map[int]int)
+	for _, line := range lines {
+		if line.ItemID <= 0 {
+			return nil, ErrInvalidItem
+		}
+		if line.Quantity <= 0 {
+			return nil, ErrInvalidQuantity
+		}
+		quantities[line.ItemID] += line.Quantity
+		if quantities[line.ItemID] > MaxQuantity {
+			return nil, ErrInvalidQuantity
+		}
+	}
+
+	merged := make([]Line, 0, len(quantities))
+	for itemID, quantity := range quantities {
+		merged = append(merged, Line{ItemID: itemID, Quantity: quantity})
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].ItemID < merged[j].ItemID })
+	return merged, nil
+}
+
+// NewPickupCode returns a random code for collecting an order.
+func NewPickupCode() (string, error) {
+	random := make([]byte, PickupCodeLength)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+
+	// Rejection sampling keeps every symbol equally likely
+	code := make([]byte, 0, PickupCodeLength)
+	limit := 256 - 256%len(pickupAlphabet)
+	for len(code) < PickupCodeLength {
+		for _, b := range random {
+			if int(b) < limit && len(code) < PickupCodeLength {
+				code = append(code, pickupAlphabet[int(b)%len(pickupAlphabet)])
+			}
+		}
+		if _, err := rand.Read(random); err != nil {
+			return "", err
+		}
+	}
+	return string(code), nil
+}
+
+// ParsePickupCode normalises a pickup code as typed at the counter.
+func ParsePickupCode(s string) (string, error) {
+	s = strings.ToUpper(strings.NewReplacer(" ", "", "-", "").Replace(s))
+	if len(s) != PickupCodeLength {
+		return "", ErrInvalidPickupCode
+	}
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte(pickupAlphabet, s[i]) < 0 {
+			return "", ErrInvalidPickupCode
+		}
+	}
+	return s, nil
+}
@@ -0,0 +1,39 @@
+// Package crockford builds the codes customers read out and type in from
+// Crockford's base32 alphabet, which leaves out I, L, O and U so codes can't
+// be misread.
+package crockford
+
+import (
+	"crypto/rand"
+	"strings"
+)
+
+// Alphabet is Crockford's base32 alphabet.
+const Alphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// Random returns n random symbols. 256 is a multiple of the alphabet's
+// length, so every symbol is equally likely.
+func Random(n int) ([]byte, error) {
+	random := make([]byte, n)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	for i, b := range random {
+		random[i] = Alphabet[int(b)%len(Alphabet)]
+	}
+	return random, nil
+}
+
+// Normalise tidies a code as typed by a customer: any case, with optional
+// spaces or dashes, O for 0 and I or L for 1. It reports whether every symbol
+// is then in the alphabet.
+func Normalise(s string) (string, bool) {
+	s = strings.ToUpper(s)
+	s = strings.NewReplacer(" ", "", "-", "", "O", "0", "I", "1", "L", "1").Replace(s)
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte(Alphabet, s[i]) < 0 {
+			return s, false
+		}
+	}
+	return s, true
+}
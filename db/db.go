@@ -3,6 +3,7 @@ package db
 import (
 	"fmt"
 	"log"
+	"net/url"
 	"os"
 	"sync"
 
@@ -37,8 +38,9 @@ func InitDB() *gorm.DB {
 			dbName = "cinema_booking"
 		}
 
-		dsn := fmt.Sprintf("%s:%s@tcp(%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
-			dbUser, dbPass, dbHost, dbName)
+		// Times are stored in UTC, see initDB in main.go
+		dsn := fmt.Sprintf("%s:%s@tcp(%s)/%s?charset=utf8mb4&parseTime=True&loc=UTC&time_zone=%s",
+			dbUser, dbPass, dbHost, dbName, url.QueryEscape("'+00:00'"))
 
 		var err error
 		db, err = gorm.Open("mysql", dsn)
@@ -47,7 +49,7 @@ func InitDB() *gorm.DB {
 		}
 
 		// Auto migrate the schema
-		db.AutoMigrate(&models.Movie{}, &models.Show{}, &models.Seat{}, &models.Booking{}, &models.User{})
+		db.AutoMigrate(&models.Movie{}, &models.Show{}, &models.Seat{}, &models.Booking{}, &models.BookingItem{}, &models.User{})
 
 		// Enable logging
 		db.LogMode(true)
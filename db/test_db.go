@@ -5,7 +5,6 @@ import (
 	"testing"
 	"github.com/go-sql-driver/mysql"
 	"os"
-	"log"
 )
 
 // TestDBConfig contains test database configuration
@@ -71,6 +70,24 @@ func GetTestDB(t *testing.T) *sql.DB {
 		t.Fatalf("Failed to create shows table: %v", err)
 	}
 
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS bookings (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			show_id INT NOT NULL,
+			user_id INT NULL,
+			user_name VARCHAR(255),
+			user_email VARCHAR(255),
+			total_amount DECIMAL(10,2) NOT NULL,
+			booking_time DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			currency CHAR(3) NULL,
+			status VARCHAR(20) NOT NULL,
+			FOREIGN KEY (show_id) REFERENCES shows(id)
+		);
+	`)
+	if err != nil {
+		t.Fatalf("Failed to create bookings table: %v", err)
+	}
+
 	_, err = db.Exec(`
 		CREATE TABLE IF NOT EXISTS seats (
 			id INT AUTO_INCREMENT PRIMARY KEY,
@@ -88,23 +105,30 @@ func GetTestDB(t *testing.T) *sql.DB {
 	}
 
 	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS bookings (
+		CREATE TABLE IF NOT EXISTS booking_items (
 			id INT AUTO_INCREMENT PRIMARY KEY,
-			show_id INT NOT NULL,
-			user_id INT NOT NULL,
-			total_amount DECIMAL(10,2) NOT NULL,
-			status VARCHAR(20) NOT NULL,
-			FOREIGN KEY (show_id) REFERENCES shows(id)
+			booking_id INT NOT NULL,
+			kind VARCHAR(20) NOT NULL,
+			description VARCHAR(255) NOT NULL,
+			seat_id INT NULL,
+			concession_id INT NULL,
+			quantity INT NOT NULL DEFAULT 1,
+			unit_amount DECIMAL(10,2) NOT NULL,
+			amount DECIMAL(10,2) NOT NULL,
+			currency CHAR(3) NOT NULL,
+			included BOOLEAN NOT NULL DEFAULT FALSE,
+			created_at DATETIME NOT NULL,
+			FOREIGN KEY (booking_id) REFERENCES bookings(id)
 		);
 	`)
 	if err != nil {
-		t.Fatalf("Failed to create bookings table: %v", err)
+		t.Fatalf("Failed to create booking_items table: %v", err)
 	}
 
 	// Clean up existing data
-	_, err = db.Exec("DELETE FROM bookings")
+	_, err = db.Exec("DELETE FROM booking_items")
 	if err != nil {
-		t.Fatalf("Failed to clean up bookings: %v", err)
+		t.Fatalf("Failed to clean up booking items: %v", err)
 	}
 
 	_, err = db.Exec("DELETE FROM seats")
@@ -112,6 +136,11 @@ func GetTestDB(t *testing.T) *sql.DB {
 		t.Fatalf("Failed to clean up seats: %v", err)
 	}
 
+	_, err = db.Exec("DELETE FROM bookings")
+	if err != nil {
+		t.Fatalf("Failed to clean up bookings: %v", err)
+	}
+
 	_, err = db.Exec("DELETE FROM shows")
 	if err != nil {
 		t.Fatalf("Failed to clean up shows: %v", err)
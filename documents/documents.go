@@ -0,0 +1,215 @@
+// Package documents renders printable PDF tickets and receipts.
+package documents
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"cinemabooking/money"
+
+	"github.com/go-pdf/fpdf"
+)
+
+// LineItem is one priced line of a receipt.
+type LineItem struct {
+	Description string
+	Quantity    int
+	UnitPrice   money.Money
+}
+
+// Amount is the line total.
+func (i LineItem) Amount() money.Money {
+	return i.UnitPrice.Mul(i.Quantity)
+}
+
+// TaxLine is a tax charged on a booking. Included tax is already part of the
+// item prices; other tax is added to them.
+type TaxLine struct {
+	Description string
+	Amount      money.Money
+	Included    bool
+}
+
+// Booking holds what tickets and receipts show. Times should already be in
+// the cinema's time zone.
+type Booking struct {
+	Reference  string
+	Customer   string
+	Email      string
+	MovieTitle string
+	Screen     string
+	StartTime  time.Time
+	BookedAt   time.Time
+	Seats      []string
+	Currency   string
+	Items      []LineItem
+	// Prices include tax at this rate, e.g. 0.2 for 20% VAT. Only used when
+	// there are no tax lines.
+	TaxRate float64
+	Taxes   []TaxLine
+	// Optional PNG of the e-ticket QR code
+	QRCode []byte
+	// Food and drink to collect, e.g. "2 x Large Popcorn", and the code to
+	// collect it with
+	Extras     []string
+	PickupCode string
+}
+
+// Total is the sum of the line items and any tax added to them.
+func (b Booking) Total() money.Money {
+	total := money.New(0, b.Currency)
+	for _, item := range b.Items {
+		total = total.Add(item.Amount())
+	}
+	for _, tax := range b.Taxes {
+		if !tax.Included {
+			total = total.Add(tax.Amount)
+		}
+	}
+	return total
+}
+
+// Tax is the tax in the total.
+func (b Booking) Tax() money.Money {
+	if len(b.Taxes) > 0 {
+		tax := money.New(0, b.Currency)
+		for _, line := range b.Taxes {
+			tax = tax.Add(line.Amount)
+		}
+		return tax
+	}
+	total := b.Total()
+	if b.TaxRate <= 0 {
+		return money.New(0, total.Currency)
+	}
+	net := int64(math.Round(float64(total.Cents) / (1 + b.TaxRate)))
+	return money.New(total.Cents-net, total.Currency)
+}
+
+// Net is the total before tax.
+func (b Booking) Net() money.Money {
+	return b.Total().Sub(b.Tax())
+}
+
+const showTimeLayout = "Monday 2 January 2006, 15:04 MST"
+
+// newDocument starts an A4 page with the cinema heading
+func newDocument(title string) (*fpdf.Fpdf, func(string) string) {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetTitle(title, true)
+	pdf.SetMargins(20, 20, 20)
+	pdf.AddPage()
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+
+	pdf.SetFont("Helvetica", "B", 20)
+	pdf.CellFormat(0, 10, "Cinema Booking", "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 12)
+	pdf.CellFormat(0, 7, tr(title), "", 1, "L", false, 0, "")
+	pdf.Ln(6)
+	return pdf, tr
+}
+
+// field writes a label and its value on one line
+func field(pdf *fpdf.Fpdf, label, value string) {
+	pdf.SetFont("Helvetica", "B", 11)
+	pdf.CellFormat(40, 7, label, "", 0, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 11)
+	pdf.MultiCell(0, 7, value, "", "L", false)
+}
+
+func output(pdf *fpdf.Fpdf) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Ticket renders the admission ticket for a booking.
+func Ticket(b Booking) ([]byte, error) {
+	pdf, tr := newDocument("Ticket " + b.Reference)
+
+	pdf.SetFont("Helvetica", "B", 16)
+	pdf.MultiCell(0, 9, tr(b.MovieTitle), "", "L", false)
+	pdf.Ln(2)
+	field(pdf, "Show time", b.StartTime.Format(showTimeLayout))
+	field(pdf, "Screen", b.Screen)
+	field(pdf, "Seats", strings.Join(b.Seats, ", "))
+	field(pdf, "Name", tr(b.Customer))
+	field(pdf, "Reference", b.Reference)
+	if b.PickupCode != "" {
+		field(pdf, "Food & drink", tr(strings.Join(b.Extras, ", ")))
+		pdf.SetFont("Helvetica", "B", 14)
+		pdf.CellFormat(40, 9, "Pickup code", "", 0, "L", false, 0, "")
+		pdf.CellFormat(0, 9, b.PickupCode, "", 1, "L", false, 0, "")
+	}
+
+	if len(b.QRCode) > 0 {
+		opts := fpdf.ImageOptions{ImageType: "PNG"}
+		pdf.RegisterImageOptionsReader("qr", opts, bytes.NewReader(b.QRCode))
+		pdf.ImageOptions("qr", 20, pdf.GetY()+6, 60, 60, false, opts, 0, "")
+		pdf.SetY(pdf.GetY() + 70)
+	}
+
+	pdf.SetFont("Helvetica", "I", 10)
+	pdf.MultiCell(0, 6, "Please show this ticket at the entrance. We recommend arriving 15 minutes before the show starts.", "", "L", false)
+
+	return output(pdf)
+}
+
+// Receipt renders the itemised tax receipt for a booking.
+func Receipt(b Booking) ([]byte, error) {
+	pdf, tr := newDocument("Receipt " + b.Reference)
+
+	field(pdf, "Reference", b.Reference)
+	field(pdf, "Date", b.BookedAt.Format(showTimeLayout))
+	field(pdf, "Customer", tr(strings.TrimSpace(b.Customer+" "+b.Email)))
+	field(pdf, "Film", tr(b.MovieTitle))
+	field(pdf, "Show time", b.StartTime.Format(showTimeLayout))
+	field(pdf, "Screen", b.Screen)
+	field(pdf, "Seats", strings.Join(b.Seats, ", "))
+	pdf.Ln(6)
+
+	// Items table
+	widths := []float64{90, 20, 30, 30}
+	pdf.SetFont("Helvetica", "B", 11)
+	pdf.SetFillColor(235, 235, 235)
+	for i, heading := range []string{"Item", "Qty", "Unit price", "Amount"} {
+		align := "R"
+		if i == 0 {
+			align = "L"
+		}
+		pdf.CellFormat(widths[i], 8, heading, "B", 0, align, true, 0, "")
+	}
+	pdf.Ln(-1)
+
+	pdf.SetFont("Helvetica", "", 11)
+	for _, item := range b.Items {
+		pdf.CellFormat(widths[0], 7, tr(item.Description), "", 0, "L", false, 0, "")
+		pdf.CellFormat(widths[1], 7, fmt.Sprint(item.Quantity), "", 0, "R", false, 0, "")
+		pdf.CellFormat(widths[2], 7, tr(item.UnitPrice.Format()), "", 0, "R", false, 0, "")
+		pdf.CellFormat(widths[3], 7, tr(item.Amount().Format()), "", 1, "R", false, 0, "")
+	}
+
+	// Totals
+	labelWidth := widths[0] + widths[1] + widths[2]
+	pdf.CellFormat(labelWidth, 7, "Net", "T", 0, "R", false, 0, "")
+	pdf.CellFormat(widths[3], 7, tr(b.Net().Format()), "T", 1, "R", false, 0, "")
+	if len(b.Taxes) > 0 {
+		for _, tax := range b.Taxes {
+			pdf.CellFormat(labelWidth, 7, tr(tax.Description), "", 0, "R", false, 0, "")
+			pdf.CellFormat(widths[3], 7, tr(tax.Amount.Format()), "", 1, "R", false, 0, "")
+		}
+	} else {
+		pdf.CellFormat(labelWidth, 7, fmt.Sprintf("VAT at %g%%", b.TaxRate*100), "", 0, "R", false, 0, "")
+		pdf.CellFormat(widths[3], 7, tr(b.Tax().Format()), "", 1, "R", false, 0, "")
+	}
+	pdf.SetFont("Helvetica", "B", 11)
+	pdf.CellFormat(labelWidth, 8, "Total paid", "", 0, "R", false, 0, "")
+	pdf.CellFormat(widths[3], 8, tr(b.Total().Format()), "", 1, "R", false, 0, "")
+
+	return output(pdf)
+}
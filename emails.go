@@ -0,0 +1,180 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"cinemabooking/notifications"
+)
+
+// Delivers customer emails
+var mailer notifications.Mailer = notifications.LogMailer{}
+
+// Send queue settings
+const (
+	mailQueueSize    = 100
+	mailWorkers      = 2
+	mailMaxAttempts  = 5
+	mailRetryBackoff = 2 * time.Second
+)
+
+// initMailer picks the mail transport from MAIL_TRANSPORT ("smtp", "outbox"
+// or "log") and sends through it from a background queue
+func initMailer() {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "tickets@cinema.local"
+	}
+
+	var transport notifications.Mailer
+	switch os.Getenv("MAIL_TRANSPORT") {
+	case "smtp":
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		transport = notifications.SMTPMailer{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     port,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		}
+	case "outbox":
+		dir := os.Getenv("MAIL_OUTBOX_DIR")
+		if dir == "" {
+			dir = "outbox"
+		}
+		transport = notifications.OutboxMailer{Dir: dir, From: from}
+	case "", "log":
+		transport = notifications.LogMailer{}
+	default:
+		log.Fatalf("Unknown MAIL_TRANSPORT %q", os.Getenv("MAIL_TRANSPORT"))
+	}
+
+	mailer = notifications.NewQueue(transport, mailQueueSize, mailWorkers, mailMaxAttempts, mailRetryBackoff)
+}
+
+// bookingEmail loads what the customer emails say about a booking
+func bookingEmail(q queryer, bookingID int) (notifications.Booking, error) {
+	var b notifications.Booking
+	var ownerID sql.NullInt64
+	var currency string
+	err := q.QueryRow(`
+		SELECT b.id, COALESCE(b.reference, ''), b.user_id, COALESCE(b.user_name, ''), COALESCE(b.user_email, ''), b.total_amount,
+			COALESCE(b.currency, ''), COALESCE(b.pickup_code, ''), m.title, s.screen, s.start_time
+		FROM bookings b
+		JOIN shows s ON s.id = b.show_id
+		JOIN movies m ON m.id = s.movie_id
+		WHERE b.id = ?
+	`, bookingID).Scan(&b.ID, &b.Reference, &ownerID, &b.Name, &b.Email, &b.Total, &currency, &b.PickupCode, &b.MovieTitle, &b.Screen, &b.StartTime)
+	if err != nil {
+		return b, err
+	}
+	b.Total.Currency = currency
+	if currency == "" {
+		b.Total.Currency = cinemaCurrency()
+	}
+
+	extras, err := bookingConcessions(q, bookingID)
+	if err != nil {
+		return b, err
+	}
+	for _, item := range extras {
+		b.Extras = append(b.Extras, fmt.Sprintf("%d x %s", item.Quantity, item.Name))
+	}
+	b.StartTime = inCinemaTime(b.StartTime)
+	if b.Reference != "" {
+		b.Link = bookingLink(b.Reference, !ownerID.Valid)
+	}
+
+	rows, err := q.Query("SELECT row_name, seat_number FROM seats WHERE booking_id = ? ORDER BY row_name, seat_number", bookingID)
+	if err != nil {
+		return b, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var rowName string
+		var seatNumber int
+		if err := rows.Scan(&rowName, &seatNumber); err != nil {
+			return b, err
+		}
+		b.Seats = append(b.Seats, rowName+strconv.Itoa(seatNumber))
+	}
+	return b, rows.Err()
+}
+
+// publicBaseURL is the site address used in links sent to customers, from
+// PUBLIC_BASE_URL
+func publicBaseURL() string {
+	baseURL := strings.TrimSuffix(os.Getenv("PUBLIC_BASE_URL"), "/")
+	if baseURL == "" {
+		baseURL = "http://localhost:8080"
+	}
+	return baseURL
+}
+
+// sendWaitlistOffer queues the email telling a waiting customer which seats
+// are held for them and where to claim them
+func sendWaitlistOffer(offer WaitlistOffer) {
+	email := notifications.WaitlistOffer{
+		Email:   offer.UserEmail,
+		Link:    fmt.Sprintf("%s/show?id=%d&hold=%s", publicBaseURL(), offer.ShowID, offer.ClaimToken),
+		Expires: inCinemaTime(offer.OfferExpiresAt),
+	}
+	err := dbConn.QueryRow(`
+		SELECT COALESCE(w.user_name, ''), m.title, s.screen, s.start_time
+		FROM waitlist_entries w
+		JOIN shows s ON s.id = w.show_id
+		JOIN movies m ON m.id = s.movie_id
+		WHERE w.id = ?
+	`, offer.EntryID).Scan(&email.Name, &email.MovieTitle, &email.Screen, &email.StartTime)
+	if err != nil {
+		log.Printf("Error loading waitlist offer %d for email: %v", offer.EntryID, err)
+		return
+	}
+	for _, seatID := range offer.SeatIDs {
+		var rowName string
+		var seatNumber int
+		err := dbConn.QueryRow("SELECT row_name, seat_number FROM seats WHERE id = ?", seatID).Scan(&rowName, &seatNumber)
+		if err != nil {
+			log.Printf("Error loading seat %d for waitlist offer %d: %v", seatID, offer.EntryID, err)
+			return
+		}
+		email.Seats = append(email.Seats, rowName+strconv.Itoa(seatNumber))
+	}
+	email.StartTime = inCinemaTime(email.StartTime)
+
+	msg, err := notifications.WaitlistSeatsOffered(email)
+	if err == nil {
+		err = mailer.Send(msg)
+	}
+	if err != nil {
+		log.Printf("Error queueing waitlist offer email for entry %d: %v", offer.EntryID, err)
+	}
+}
+
+// sendBookingConfirmation queues the confirmation email for a new booking
+func sendBookingConfirmation(bookingID int) {
+	booking, err := bookingEmail(dbConn, bookingID)
+	if err != nil {
+		log.Printf("Error loading booking %d for confirmation email: %v", bookingID, err)
+		return
+	}
+	if booking.Email == "" {
+		return
+	}
+
+	msg, err := notifications.BookingConfirmation(booking)
+	if err == nil {
+		err = mailer.Send(msg)
+	}
+	if err != nil {
+		log.Printf("Error queueing confirmation email for booking %d: %v", bookingID, err)
+	}
+}
@@ -3,13 +3,13 @@ module cinemabooking
 go 1.21
 
 require (
+	github.com/go-pdf/fpdf v0.9.0
+	github.com/go-sql-driver/mysql v1.7.1
 	github.com/gorilla/mux v1.8.1
 	github.com/jinzhu/gorm v1.9.16
+	github.com/joho/godotenv v1.5.1
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
+	golang.org/x/crypto v0.17.0
 )
 
-require (
-	github.com/go-sql-driver/mysql v1.7.1 // indirect
-	github.com/jinzhu/inflection v1.0.0 // indirect
-	github.com/joho/godotenv v1.5.1 // indirect
-	golang.org/x/crypto v0.17.0 // indirect
-)
+require github.com/jinzhu/inflection v1.0.0 // indirect
@@ -2,11 +2,14 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"os"
 	"sync"
 
 	"cinemabooking/db"
 	"cinemabooking/models"
+	"cinemabooking/money"
 
 	"github.com/gorilla/mux"
 )
@@ -93,7 +96,17 @@ func CreateBooking(w http.ResponseWriter, r *http.Request) {
 	db := db.GetDB()
 	tx := db.Begin()
 
-	// Check if seats are available and lock them
+	var show models.Show
+	if err := tx.First(&show, bookingRequest.ShowID).Error; err != nil {
+		tx.Rollback()
+		http.Error(w, "Show not found", http.StatusNotFound)
+		return
+	}
+	currency := money.ParseCurrency(os.Getenv("CURRENCY"))
+	show.Price.Currency = currency
+
+	// Check if seats are available and lock them, pricing each one
+	var items []models.BookingItem
 	for _, seatID := range bookingRequest.SeatIDs {
 		lock := getSeatLock(seatID)
 		lock.Lock()
@@ -118,14 +131,29 @@ func CreateBooking(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+
+		seatID := seat.ID
+		items = append(items, models.BookingItem{
+			Kind:        "seat",
+			Description: fmt.Sprintf("Seat %s%d", seat.Row, seat.Number),
+			SeatID:      &seatID,
+			Quantity:    1,
+			UnitAmount:  show.Price,
+			Amount:      show.Price,
+			Currency:    currency,
+		})
 	}
 
-	// Create booking
+	// Create booking; the total is the sum of its items
 	booking := models.Booking{
 		ShowID:      bookingRequest.ShowID,
 		UserID:      bookingRequest.UserID,
 		Status:      "confirmed",
-		TotalAmount: 0, // Calculate based on show price
+		TotalAmount: money.New(0, currency),
+		Currency:    currency,
+	}
+	for _, item := range items {
+		booking.TotalAmount = booking.TotalAmount.Add(item.Amount)
 	}
 
 	if err := tx.Create(&booking).Error; err != nil {
@@ -134,6 +162,16 @@ func CreateBooking(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	for i := range items {
+		items[i].BookingID = booking.ID
+		if err := tx.Create(&items[i]).Error; err != nil {
+			tx.Rollback()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	booking.Items = items
+
 	// Update seats with booking ID
 	if err := tx.Model(&models.Seat{}).Where("id IN (?)", bookingRequest.SeatIDs).
 		Updates(map[string]interface{}{
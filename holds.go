@@ -0,0 +1,62 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"time"
+)
+
+// How long seats stay held for a customer before they are released
+const seatHoldDuration = 10 * time.Minute
+
+// execer is satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// seatBookable reports whether a seat can be booked by a customer presenting
+// holdToken (which may be empty)
+func seatBookable(status, seatHoldToken, holdToken string) bool {
+	if status == "available" {
+		return true
+	}
+	return status == "held" && holdToken != "" && seatHoldToken == holdToken
+}
+
+// releaseExpiredHolds frees the seats of a show whose hold has run out
+func releaseExpiredHolds(e execer, showID int) error {
+	_, err := e.Exec(`
+		UPDATE seats SET status = 'available', hold_token = NULL, held_until = NULL
+		WHERE show_id = ? AND status = 'held' AND held_until < NOW()
+	`, showID)
+	return err
+}
+
+// holdSeats marks seats as held under a new token for the given duration
+func holdSeats(tx *sql.Tx, seatIDs []int, duration time.Duration) (string, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	for _, seatID := range seatIDs {
+		_, err := tx.Exec(`
+			UPDATE seats SET status = 'held', hold_token = ?, held_until = DATE_ADD(NOW(), INTERVAL ? SECOND)
+			WHERE id = ? AND status = 'available'
+		`, token, int(duration.Seconds()), seatID)
+		if err != nil {
+			return "", err
+		}
+	}
+	return token, nil
+}
+
+// newToken returns a random hex token for hold and claim links
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
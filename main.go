@@ -7,7 +7,17 @@ import (
 	"html/template"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
+	"time"
+
+	"cinemabooking/auth"
+	"cinemabooking/cinematime"
+	"cinemabooking/concessions"
+	"cinemabooking/money"
+	"cinemabooking/pagination"
+	"cinemabooking/pricing"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/gorilla/mux"
@@ -17,6 +27,14 @@ import (
 // Database connection
 var dbConn *sql.DB
 
+// Time zone the cinema operates in, used for show dates and display
+var cinemaLocation *time.Location
+
+// inCinemaTime converts a stored UTC time to the cinema's time zone for display
+func inCinemaTime(t time.Time) time.Time {
+	return t.In(cinemaLocation)
+}
+
 // Initialize database connection
 func initDB() {
 	err := godotenv.Load()
@@ -29,7 +47,14 @@ func initDB() {
 	dbName := os.Getenv("DB_NAME")
 	dbHost := os.Getenv("DB_HOST")
 
-	dsn := dbUser + ":" + dbPass + "@tcp(" + dbHost + ")/" + dbName + "?parseTime=true"
+	cinemaLocation, err = cinematime.LoadLocation(os.Getenv("CINEMA_TIMEZONE"))
+	if err != nil {
+		log.Fatal("Error loading CINEMA_TIMEZONE:", err)
+	}
+
+	// Times are stored in UTC and the session time zone is pinned to UTC so
+	// NOW() agrees with the values written from Go
+	dsn := dbUser + ":" + dbPass + "@tcp(" + dbHost + ")/" + dbName + "?parseTime=true&loc=UTC&time_zone=" + url.QueryEscape("'+00:00'")
 	dbConn, err = sql.Open("mysql", dsn)
 	if err != nil {
 		log.Fatal(err)
@@ -162,25 +187,38 @@ func initDB() {
 	}
 
 	log.Println("Database tables created successfully")
+
+	migrateDB()
 }
 
 type Movie struct {
-	ID          int    `json:"id"`
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	Duration    int    `json:"duration"`
-	Rating      string `json:"rating"`
-	PosterURL   string `json:"poster_url"`
+	ID           int        `json:"id"`
+	Title        string     `json:"title"`
+	Description  string     `json:"description"`
+	Duration     int        `json:"duration"`
+	Rating       string     `json:"rating"`
+	PosterURL    string     `json:"poster_url"`
+	NextShowtime *time.Time `json:"next_showtime,omitempty"`
 }
 
 type Show struct {
-	ID        int     `json:"id"`
-	MovieID   int     `json:"movie_id"`
-	Screen    string  `json:"screen"`
-	StartTime string  `json:"start_time"`
-	EndTime   string  `json:"end_time"`
-	Price     float64 `json:"price"`
-	Duration  int     `json:"duration"`
+	ID        int         `json:"id"`
+	MovieID   int         `json:"movie_id"`
+	Screen    string      `json:"screen"`
+	StartTime time.Time   `json:"start_time"`
+	EndTime   time.Time   `json:"end_time"`
+	TimeZone  string      `json:"time_zone"`
+	Price     money.Money `json:"price"`
+	Duration  int         `json:"duration"`
+	Status    string      `json:"status"` // scheduled, cancelled
+	SeatCounts
+}
+
+// localise puts the show's times in the cinema's time zone
+func (show *Show) localise() {
+	show.StartTime = inCinemaTime(show.StartTime)
+	show.EndTime = inCinemaTime(show.EndTime)
+	show.TimeZone = cinemaLocation.String()
 }
 
 type Seat struct {
@@ -189,18 +227,36 @@ type Seat struct {
 	Row        string `json:"row" db:"row_name"`
 	SeatNumber int    `json:"seat_number"`
 	Status     string `json:"status"`
+	Category   string `json:"category"`
+	Accessible bool   `json:"accessible"`
+	// Ticket price, listed with the seat map
+	Price *money.Money `json:"price,omitempty"`
 }
 
 // Add booking struct
 type Booking struct {
-	ID          int     `json:"id"`
-	ShowID      int     `json:"show_id"`
-	UserName    string  `json:"user_name"`
-	UserEmail   string  `json:"user_email"`
-	SeatIDs     []int   `json:"seat_ids"`
-	TotalAmount float64 `json:"total_amount"`
-	BookingTime string  `json:"booking_time"`
-	Status      string  `json:"status"`
+	ID          int         `json:"id"`
+	Reference   string      `json:"reference"`
+	ShowID      int         `json:"show_id"`
+	UserName    string      `json:"user_name"`
+	UserEmail   string      `json:"user_email"`
+	SeatIDs     []int       `json:"seat_ids"`
+	TotalAmount money.Money `json:"total_amount"`
+	Currency    string      `json:"currency"`
+	BookingTime time.Time   `json:"booking_time"`
+	Status      string      `json:"status"`
+	// What the total is made of: seats, fees, discounts, taxes and add-ons
+	Items []BookingItem `json:"items,omitempty"`
+	// Part of the total paid with gift vouchers
+	VoucherAmount money.Money `json:"voucher_amount"`
+	// Food and drink ordered with the booking, collected with the pickup code
+	Concessions []BookedConcession `json:"concessions,omitempty"`
+	PickupCode  string             `json:"pickup_code,omitempty"`
+	// Links between a booking and the one it was exchanged for
+	ExchangedFrom *int `json:"exchanged_from,omitempty"`
+	ExchangedTo   *int `json:"exchanged_to,omitempty"`
+	// Lets a guest open the booking again; only returned when it is made
+	AccessToken string `json:"access_token,omitempty"`
 }
 
 func seedDB() {
@@ -260,21 +316,36 @@ func seedDB() {
 		log.Println("Added movies successfully")
 	}
 
-	// Add shows
-	_, err = dbConn.Exec(`
-		INSERT INTO shows (movie_id, screen, start_time, end_time, price) VALUES
-		(1, 'Screen 1', '2024-03-20 14:00:00', '2024-03-20 16:32:00', 12.99),
-		(1, 'Screen 2', '2024-03-20 18:00:00', '2024-03-20 20:32:00', 14.99),
-		(2, 'Screen 1', '2024-03-20 15:00:00', '2024-03-20 17:28:00', 12.99),
-		(2, 'Screen 3', '2024-03-20 19:00:00', '2024-03-20 21:28:00', 14.99),
-		(3, 'Screen 2', '2024-03-20 16:00:00', '2024-03-20 18:22:00', 12.99),
-		(3, 'Screen 1', '2024-03-20 20:00:00', '2024-03-20 22:22:00', 14.99)
-	`)
-	if err != nil {
-		log.Printf("Error adding shows: %v", err)
-	} else {
-		log.Println("Added shows successfully")
+	// Add shows, given in cinema local time and stored in UTC
+	seedShows := []struct {
+		movieID  int
+		screen   string
+		start    string
+		duration time.Duration
+		price    float64
+	}{
+		{1, "Screen 1", "2024-03-20 14:00", 152 * time.Minute, 12.99},
+		{1, "Screen 2", "2024-03-20 18:00", 152 * time.Minute, 14.99},
+		{2, "Screen 1", "2024-03-20 15:00", 148 * time.Minute, 12.99},
+		{2, "Screen 3", "2024-03-20 19:00", 148 * time.Minute, 14.99},
+		{3, "Screen 2", "2024-03-20 16:00", 142 * time.Minute, 12.99},
+		{3, "Screen 1", "2024-03-20 20:00", 142 * time.Minute, 14.99},
 	}
+	for _, show := range seedShows {
+		start, err := time.ParseInLocation("2006-01-02 15:04", show.start, cinemaLocation)
+		if err != nil {
+			log.Printf("Error parsing show time %s: %v", show.start, err)
+			continue
+		}
+		_, err = dbConn.Exec(`
+			INSERT INTO shows (movie_id, screen, start_time, end_time, price)
+			VALUES (?, ?, ?, ?, ?)
+		`, show.movieID, show.screen, start.UTC(), start.Add(show.duration).UTC(), show.price)
+		if err != nil {
+			log.Printf("Error adding show: %v", err)
+		}
+	}
+	log.Println("Added shows successfully")
 
 	// Get all show IDs
 	rows, err := dbConn.Query("SELECT id FROM shows")
@@ -316,6 +387,26 @@ func seedDB() {
 		log.Printf("Added seats for show %d", showID)
 	}
 
+	// Add the concessions menu, unless one has been set up already
+	var concessionCount int
+	dbConn.QueryRow("SELECT COUNT(*) FROM concessions").Scan(&concessionCount)
+	if concessionCount == 0 {
+		_, err = dbConn.Exec(`
+			INSERT INTO concessions (name, description, category, price, stock) VALUES
+			('Regular Popcorn', 'Salted or sweet', 'snack', 4.50, 200),
+			('Large Popcorn', 'Salted or sweet', 'snack', 6.00, 200),
+			('Nachos', 'With cheese sauce', 'snack', 5.50, 100),
+			('Soft Drink', 'Regular cola, lemonade or orange', 'drink', 3.50, 300),
+			('Bottled Water', '500ml', 'drink', 2.00, 300),
+			('Movie Combo', 'Large popcorn and two soft drinks', 'combo', 11.50, 100)
+		`)
+		if err != nil {
+			log.Printf("Error adding concessions: %v", err)
+		} else {
+			log.Println("Added concessions successfully")
+		}
+	}
+
 	// Verify final counts
 	dbConn.QueryRow("SELECT COUNT(*) FROM movies").Scan(&movieCount)
 	dbConn.QueryRow("SELECT COUNT(*) FROM shows").Scan(&showCount)
@@ -340,6 +431,9 @@ func main() {
 		return
 	}
 
+	initMailer()
+	initPricing()
+
 	r := mux.NewRouter()
 
 	// Serve static files
@@ -350,16 +444,61 @@ func main() {
 	r.HandleFunc("/movies", serveMovies).Methods("GET")
 	r.HandleFunc("/movies/details", serveMovieDetails).Methods("GET")
 	r.HandleFunc("/show", serveShowDetails).Methods("GET")
-	r.HandleFunc("/booking/{id}", serveBooking).Methods("GET")
+	r.HandleFunc("/booking/{ref}", serveBooking).Methods("GET")
+	r.HandleFunc("/checkin", serveCheckin).Methods("GET")
 
 	// API routes
 	r.HandleFunc("/api/movies/all", getAllMovies).Methods("GET")
 	r.HandleFunc("/api/movies/details", getMovie).Methods("GET")
 	r.HandleFunc("/api/movies/shows", getShows).Methods("GET")
 	r.HandleFunc("/api/shows/{id}", getShow).Methods("GET")
+	r.HandleFunc("/api/showtimes", getShowtimes).Methods("GET")
 	r.HandleFunc("/api/shows/{id}/seats", getSeats).Methods("GET")
+	r.HandleFunc("/api/shows/{id}/seats/suggest", suggestSeats).Methods("POST")
+	r.HandleFunc("/api/shows/{id}/quote", quoteBooking).Methods("POST")
 	r.HandleFunc("/api/bookings", createBooking).Methods("POST")
-	r.HandleFunc("/api/bookings/{id}", getBooking).Methods("GET")
+	r.HandleFunc("/api/bookings/{ref}", getBooking).Methods("GET")
+	r.HandleFunc("/api/bookings/{ref}/exchange", exchangeBooking).Methods("POST")
+	r.HandleFunc("/api/bookings/{ref}/ticket.png", getTicket).Methods("GET")
+	r.HandleFunc("/api/bookings/{ref}/ticket.pdf", getTicketPDF).Methods("GET")
+	r.HandleFunc("/api/bookings/{ref}/receipt.pdf", getReceiptPDF).Methods("GET")
+	r.HandleFunc("/api/users", registerUser).Methods("POST")
+	r.HandleFunc("/api/sessions", login).Methods("POST")
+	r.HandleFunc("/api/sessions", logout).Methods("DELETE")
+	r.HandleFunc("/api/me/bookings", getMyBookings).Methods("GET")
+	r.HandleFunc("/api/shows/{id}/waitlist", joinWaitlist).Methods("POST")
+	r.HandleFunc("/api/waitlist/{token}", getWaitlistOffer).Methods("GET")
+	r.HandleFunc("/api/vouchers/{code}", getVoucherBalance).Methods("GET")
+	r.HandleFunc("/api/concessions", getConcessions).Methods("GET")
+
+	// Staff routes
+	admin := r.PathPrefix("/api/admin").Subrouter()
+	admin.Handle("/shows/{id}/seats/release", requirePermission(auth.PermManageSchedules, releaseSeats)).Methods("POST")
+	admin.Handle("/shows/{id}/seat-rules", requirePermission(auth.PermManageSchedules, updateShowSeatRules)).Methods("PUT")
+	admin.Handle("/shows/{id}/price", requirePermission(auth.PermManagePrices, updateShowPrice)).Methods("PUT")
+	admin.Handle("/shows/{id}/price/simulate", requirePermission(auth.PermManagePrices, simulateShowPrice)).Methods("POST")
+	admin.Handle("/schedules", requirePermission(auth.PermManageSchedules, createSchedule)).Methods("POST")
+	admin.Handle("/shows/{id}/cancel", requirePermission(auth.PermManageSchedules, cancelShow)).Methods("POST")
+	admin.Handle("/bookings/{ref}/refund", requirePermission(auth.PermRefund, refundBooking)).Methods("POST")
+	admin.Handle("/box-office/tills", requirePermission(auth.PermSellTickets, openTill)).Methods("POST")
+	admin.Handle("/box-office/tills/current", requirePermission(auth.PermSellTickets, getCurrentTill)).Methods("GET")
+	admin.Handle("/box-office/tills/current/close", requirePermission(auth.PermSellTickets, closeTill)).Methods("POST")
+	admin.Handle("/box-office/tills/{id:[0-9]+}", requirePermission(auth.PermSellTickets, getTill)).Methods("GET")
+	admin.Handle("/box-office/bookings", requirePermission(auth.PermSellTickets, createBoxOfficeBooking)).Methods("POST")
+	admin.Handle("/vouchers", requirePermission(auth.PermManageVouchers, issueVoucher)).Methods("POST")
+	admin.Handle("/vouchers/transactions", requirePermission(auth.PermManageVouchers, listVoucherTransactions)).Methods("GET")
+	admin.Handle("/vouchers/{code}", requirePermission(auth.PermManageVouchers, getVoucherLedger)).Methods("GET")
+	admin.Handle("/concessions", requirePermission(auth.PermManageConcessions, getAllConcessions)).Methods("GET")
+	admin.Handle("/concessions", requirePermission(auth.PermManageConcessions, createConcession)).Methods("POST")
+	admin.Handle("/concessions/{id:[0-9]+}", requirePermission(auth.PermManageConcessions, updateConcession)).Methods("PUT")
+	admin.Handle("/concessions/pickups/{code}", requirePermission(auth.PermSellTickets, getConcessionPickup)).Methods("GET")
+	admin.Handle("/concessions/pickups/{code}/collect", requirePermission(auth.PermSellTickets, collectConcessionPickup)).Methods("POST")
+	admin.Handle("/users", requirePermission(auth.PermManageUsers, listUsers)).Methods("GET")
+	admin.Handle("/users/{id}/role", requirePermission(auth.PermManageUsers, setUserRole)).Methods("PUT")
+	r.Handle("/api/checkin", requirePermission(auth.PermCheckIn, checkIn)).Methods("POST")
+
+	go runWaitlistSweeper()
+	go runReminderScheduler()
 
 	port := "8080"
 	log.Printf("Server starting on port %s", port)
@@ -389,18 +528,23 @@ func serveShowDetails(w http.ResponseWriter, r *http.Request) {
 func getAllMovies(w http.ResponseWriter, r *http.Request) {
 	log.Println("Getting all movies")
 
+	query, err := parseMovieQuery(r.URL.Query())
+	if err != nil {
+		log.Printf("Invalid movie query: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Test database connection
-	err := dbConn.Ping()
+	err = dbConn.Ping()
 	if err != nil {
 		log.Printf("Database connection error: %v", err)
 		http.Error(w, "Database connection error", http.StatusInternalServerError)
 		return
 	}
 
-	rows, err := dbConn.Query(`
-		SELECT id, title, description, duration, rating, poster_url 
-		FROM movies
-	`)
+	stmt, args := query.sql(time.Now())
+	rows, err := dbConn.Query(stmt, args...)
 	if err != nil {
 		log.Printf("Error fetching movies: %v", err)
 		http.Error(w, "Failed to fetch movies", http.StatusInternalServerError)
@@ -408,23 +552,52 @@ func getAllMovies(w http.ResponseWriter, r *http.Request) {
 	}
 	defer rows.Close()
 
-	var movies []Movie
+	movies := []Movie{}
 	for rows.Next() {
 		var movie Movie
-		err := rows.Scan(&movie.ID, &movie.Title, &movie.Description, &movie.Duration, &movie.Rating, &movie.PosterURL)
+		var nextShowtime sql.NullTime
+		err := rows.Scan(&movie.ID, &movie.Title, &movie.Description, &movie.Duration, &movie.Rating, &movie.PosterURL, &nextShowtime)
 		if err != nil {
 			log.Printf("Error scanning movie: %v", err)
 			http.Error(w, "Failed to scan movie", http.StatusInternalServerError)
 			return
 		}
+		if nextShowtime.Valid {
+			next := inCinemaTime(nextShowtime.Time)
+			movie.NextShowtime = &next
+		}
 		movies = append(movies, movie)
 	}
 
+	// The extra row fetched tells us there is another page
+	if len(movies) > query.limit {
+		movies = movies[:query.limit]
+		last := movies[len(movies)-1]
+		w.Header().Set("X-Next-Cursor", movieCursor(query.sort, last).Encode())
+	}
+
 	log.Printf("Found %d movies", len(movies))
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(movies)
 }
 
+// movieCursor points at the given movie in the requested sort order
+func movieCursor(sort string, movie Movie) pagination.Cursor {
+	cursor := pagination.Cursor{Sort: sort, ID: movie.ID}
+	switch sort {
+	case "title":
+		cursor.Key = &movie.Title
+	case "rating":
+		cursor.Key = &movie.Rating
+	case "next_showtime":
+		if movie.NextShowtime != nil {
+			key := movie.NextShowtime.UTC().Format("2006-01-02 15:04:05")
+			cursor.Key = &key
+		}
+	}
+	return cursor
+}
+
 func getMovie(w http.ResponseWriter, r *http.Request) {
 	var movieID string
 	vars := mux.Vars(r)
@@ -496,10 +669,13 @@ func getShows(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("Executing shows query for movie ID: %s", movieID)
 	rows, err := dbConn.Query(`
-		SELECT s.id, s.movie_id, s.screen, s.start_time, s.end_time, s.price, m.duration
+		SELECT s.id, s.movie_id, s.screen, s.start_time, s.end_time, s.price, m.duration, s.status,`+seatCountColumns+`
 		FROM shows s
 		JOIN movies m ON s.movie_id = m.id
+		LEFT JOIN seats seat ON seat.show_id = s.id
 		WHERE s.movie_id = ?
+		GROUP BY s.id, s.movie_id, s.screen, s.start_time, s.end_time, s.price, m.duration, s.status
+		ORDER BY s.start_time
 	`, movieID)
 	if err != nil {
 		log.Printf("Error fetching shows: %v", err)
@@ -511,12 +687,16 @@ func getShows(w http.ResponseWriter, r *http.Request) {
 	var shows []Show
 	for rows.Next() {
 		var show Show
-		err := rows.Scan(&show.ID, &show.MovieID, &show.Screen, &show.StartTime, &show.EndTime, &show.Price, &show.Duration)
+		dest := append([]interface{}{&show.ID, &show.MovieID, &show.Screen, &show.StartTime, &show.EndTime, &show.Price, &show.Duration, &show.Status}, show.SeatCounts.scanDest()...)
+		err := rows.Scan(dest...)
 		if err != nil {
 			log.Printf("Error scanning show: %v", err)
 			http.Error(w, "Failed to scan show", http.StatusInternalServerError)
 			return
 		}
+		show.SeatCounts.summarise()
+		show.Price = dynamicPrice(show.Price, show.SeatCounts, show.StartTime)
+		show.localise()
 		shows = append(shows, show)
 	}
 
@@ -530,16 +710,22 @@ func getShow(w http.ResponseWriter, r *http.Request) {
 	showID := vars["id"]
 
 	var show Show
+	dest := append([]interface{}{&show.ID, &show.MovieID, &show.Screen, &show.StartTime, &show.EndTime, &show.Price, &show.Duration, &show.Status}, show.SeatCounts.scanDest()...)
 	err := dbConn.QueryRow(`
-		SELECT s.id, s.movie_id, s.screen, s.start_time, s.end_time, s.price, m.duration
+		SELECT s.id, s.movie_id, s.screen, s.start_time, s.end_time, s.price, m.duration, s.status,`+seatCountColumns+`
 		FROM shows s
 		JOIN movies m ON s.movie_id = m.id
+		LEFT JOIN seats seat ON seat.show_id = s.id
 		WHERE s.id = ?
-	`, showID).Scan(&show.ID, &show.MovieID, &show.Screen, &show.StartTime, &show.EndTime, &show.Price, &show.Duration)
+		GROUP BY s.id, s.movie_id, s.screen, s.start_time, s.end_time, s.price, m.duration, s.status
+	`, showID).Scan(dest...)
 	if err != nil {
 		http.Error(w, "Show not found", http.StatusNotFound)
 		return
 	}
+	show.SeatCounts.summarise()
+	show.Price = dynamicPrice(show.Price, show.SeatCounts, show.StartTime)
+	show.localise()
 
 	json.NewEncoder(w).Encode(show)
 }
@@ -564,6 +750,13 @@ func getSeats(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Seats whose hold has run out are free again
+	if id, err := strconv.Atoi(showID); err == nil {
+		if err := releaseExpiredHolds(dbConn, id); err != nil {
+			log.Printf("Error releasing expired holds: %v", err)
+		}
+	}
+
 	// Count seats for this show
 	var seatCount int
 	err = dbConn.QueryRow("SELECT COUNT(*) FROM seats WHERE show_id = ?", showID).Scan(&seatCount)
@@ -596,7 +789,7 @@ func getSeats(w http.ResponseWriter, r *http.Request) {
 
 	// Get all seat details
 	rows, err = dbConn.Query(`
-		SELECT id, show_id, row_name, seat_number, status 
+		SELECT id, show_id, row_name, seat_number, status, category, accessible
 		FROM seats 
 		WHERE show_id = ?
 		ORDER BY row_name, seat_number
@@ -613,7 +806,7 @@ func getSeats(w http.ResponseWriter, r *http.Request) {
 
 	for rows.Next() {
 		var seat Seat
-		err := rows.Scan(&seat.ID, &seat.ShowID, &seat.Row, &seat.SeatNumber, &seat.Status)
+		err := rows.Scan(&seat.ID, &seat.ShowID, &seat.Row, &seat.SeatNumber, &seat.Status, &seat.Category, &seat.Accessible)
 		if err != nil {
 			log.Printf("Error scanning seat: %v", err)
 			http.Error(w, "Failed to scan seat", http.StatusInternalServerError)
@@ -640,6 +833,29 @@ func getSeats(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Row %s: %d seats", row, count)
 	}
 
+	// The price shown with the seats is honoured at checkout for a while, in
+	// case demand raises it in the meantime
+	if id, err := strconv.Atoi(showID); err == nil {
+		price := noMoney()
+		err := dbConn.QueryRow("SELECT price FROM shows WHERE id = ?", id).Scan(&price)
+		if err == nil {
+			price, err = currentShowPrice(dbConn, id, price)
+		}
+		var offer string
+		if err == nil {
+			offer, err = offerPrice(id, price)
+		}
+		if err != nil {
+			log.Printf("Error pricing show %d: %v", id, err)
+			http.Error(w, "Failed to price seats", http.StatusInternalServerError)
+			return
+		}
+		for i := range seats {
+			seats[i].Price = &price
+		}
+		w.Header().Set("X-Price-Offer", offer)
+	}
+
 	log.Printf("Successfully retrieved %d seats", len(seats))
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(seats)
@@ -661,6 +877,13 @@ func createBooking(w http.ResponseWriter, r *http.Request) {
 		SeatIDs   []int  `json:"seat_ids"`
 		UserName  string `json:"user_name"`
 		UserEmail string `json:"user_email"`
+		HoldToken string `json:"hold_token"`
+		// Optional gift voucher paying some or all of the total
+		VoucherCode string `json:"voucher_code"`
+		// Optional food and drink
+		Concessions []concessions.Line `json:"concessions"`
+		// Price offer issued with the seat map, honoured for a while
+		PriceOffer string `json:"price_offer"`
 	}
 
 	err := json.NewDecoder(r.Body).Decode(&bookingRequest)
@@ -672,17 +895,17 @@ func createBooking(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("Booking request: Show ID=%d, Seats=%v", bookingRequest.ShowID, bookingRequest.SeatIDs)
 
-	// Get show information to calculate price
-	var showPrice float64
-	err = dbConn.QueryRow("SELECT price FROM shows WHERE id = ?", bookingRequest.ShowID).Scan(&showPrice)
+	// Logged-in customers own their bookings; guests get an access token
+	user, err := currentUser(r)
 	if err != nil {
-		log.Printf("Error fetching show price: %v", err)
-		http.Error(w, "Show not found", http.StatusNotFound)
+		log.Printf("Error fetching session: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
 		return
 	}
-
-	// Calculate total price
-	totalAmount := showPrice * float64(len(bookingRequest.SeatIDs))
+	var userID *int
+	if user != nil {
+		userID = &user.ID
+	}
 
 	// Begin transaction
 	tx, err := dbConn.Begin()
@@ -693,55 +916,102 @@ func createBooking(w http.ResponseWriter, r *http.Request) {
 	}
 	defer tx.Rollback()
 
-	// Check if all seats are available
-	for _, seatID := range bookingRequest.SeatIDs {
-		var status string
-		err := tx.QueryRow("SELECT status FROM seats WHERE id = ? AND show_id = ? FOR UPDATE", seatID, bookingRequest.ShowID).Scan(&status)
-		if err != nil {
-			log.Printf("Error checking seat %d: %v", seatID, err)
-			http.Error(w, "Seat not found", http.StatusNotFound)
-			return
-		}
+	// Get show information to calculate price. The shared lock makes a show
+	// being cancelled wait for this booking, or this booking see it cancelled.
+	showPrice := noMoney()
+	var enforceSeatGaps bool
+	var showStatus string
+	err = tx.QueryRow("SELECT price, enforce_seat_gaps, status FROM shows WHERE id = ? LOCK IN SHARE MODE", bookingRequest.ShowID).Scan(&showPrice, &enforceSeatGaps, &showStatus)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Show not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching show price: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if showStatus == "cancelled" {
+		http.Error(w, "Show has been cancelled", http.StatusConflict)
+		return
+	}
 
-		if status != "available" {
-			log.Printf("Seat %d is not available (status: %s)", seatID, status)
-			http.Error(w, "Some seats are not available", http.StatusConflict)
-			return
-		}
+	// Demand may have raised the price since the customer saw it
+	showPrice, err = currentShowPrice(tx, bookingRequest.ShowID, showPrice)
+	if err != nil {
+		log.Printf("Error pricing show %d: %v", bookingRequest.ShowID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	showPrice = honourPriceOffer(bookingRequest.ShowID, bookingRequest.PriceOffer, showPrice)
+
+	// Check the seats are free (or held for this customer) and pass the
+	// show's seating rules
+	err = reserveSeatsTx(tx, bookingRequest.ShowID, bookingRequest.SeatIDs, bookingRequest.HoldToken, enforceSeatGaps)
+	if err != nil {
+		writeSeatError(w, err)
+		return
+	}
+
+	orderedConcessions, err := reserveConcessionsTx(tx, bookingRequest.Concessions)
+	if err != nil {
+		writeConcessionError(w, err)
+		return
+	}
+
+	// The total is the sum of the seats at the show's price, any food and
+	// drink, and the fees and taxes for online sales
+	items, err := quoteItems(tx, bookingRequest.ShowID, showPrice, bookingRequest.SeatIDs, orderedConcessions, pricing.Web)
+	if err != nil {
+		log.Printf("Error pricing booking: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
 	}
+	totalAmount := itemsTotal(items)
 
 	// Create booking record
-	var bookingID int
-	result, err := tx.Exec(`
-		INSERT INTO bookings (show_id, user_name, user_email, total_amount, booking_time, status)
-		VALUES (?, ?, ?, ?, NOW(), 'confirmed')
-	`, bookingRequest.ShowID, bookingRequest.UserName, bookingRequest.UserEmail, totalAmount)
+	bookingTime := time.Now().UTC()
+	bookingID, reference, err := insertBookingTx(tx, bookingRequest.ShowID, userID, bookingRequest.UserName, bookingRequest.UserEmail, pricing.Web, items, bookingTime)
 	if err != nil {
 		log.Printf("Error creating booking: %v", err)
 		http.Error(w, "Error creating booking", http.StatusInternalServerError)
 		return
 	}
 
-	bookingID64, err := result.LastInsertId()
+	pickupCode, err := attachConcessionsTx(tx, bookingID, orderedConcessions)
 	if err != nil {
-		log.Printf("Error getting booking ID: %v", err)
+		log.Printf("Error recording concessions: %v", err)
 		http.Error(w, "Error creating booking", http.StatusInternalServerError)
 		return
 	}
-	bookingID = int(bookingID64)
 
-	// Update seat status to booked
-	for _, seatID := range bookingRequest.SeatIDs {
-		_, err := tx.Exec(`
-			UPDATE seats SET status = 'booked', booking_id = ? WHERE id = ?
-		`, bookingID, seatID)
+	voucherAmount := noMoney()
+	if bookingRequest.VoucherCode != "" {
+		voucherAmount, err = redeemVoucherTx(tx, bookingRequest.VoucherCode, bookingID, totalAmount)
 		if err != nil {
-			log.Printf("Error updating seat %d: %v", seatID, err)
-			http.Error(w, "Error updating seat status", http.StatusInternalServerError)
+			writeVoucherError(w, err)
 			return
 		}
 	}
 
+	// Seats offered from the waitlist are claimed by this booking
+	if bookingRequest.HoldToken != "" {
+		err = claimWaitlistOffer(tx, bookingRequest.HoldToken, bookingID)
+		if err != nil {
+			log.Printf("Error claiming waitlist offer: %v", err)
+			http.Error(w, "Error creating booking", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Update seat status to booked
+	err = assignSeatsTx(tx, bookingID, bookingRequest.SeatIDs)
+	if err != nil {
+		log.Printf("Error updating seats: %v", err)
+		http.Error(w, "Error updating seat status", http.StatusInternalServerError)
+		return
+	}
+
 	// Commit transaction
 	err = tx.Commit()
 	if err != nil {
@@ -750,17 +1020,29 @@ func createBooking(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Printf("Booking successfully created. ID: %d", bookingID)
+	log.Printf("Booking successfully created. ID: %d, reference: %s", bookingID, reference)
+
+	sendBookingConfirmation(bookingID)
 
 	// Return booking information
 	booking := Booking{
-		ID:          bookingID,
-		ShowID:      bookingRequest.ShowID,
-		UserName:    bookingRequest.UserName,
-		UserEmail:   bookingRequest.UserEmail,
-		SeatIDs:     bookingRequest.SeatIDs,
-		TotalAmount: totalAmount,
-		Status:      "confirmed",
+		ID:            bookingID,
+		Reference:     reference,
+		ShowID:        bookingRequest.ShowID,
+		UserName:      bookingRequest.UserName,
+		UserEmail:     bookingRequest.UserEmail,
+		SeatIDs:       bookingRequest.SeatIDs,
+		TotalAmount:   totalAmount,
+		Currency:      cinemaCurrency(),
+		BookingTime:   inCinemaTime(bookingTime),
+		Status:        "confirmed",
+		Items:         items,
+		VoucherAmount: voucherAmount,
+		Concessions:   orderedConcessions,
+		PickupCode:    pickupCode,
+	}
+	if user == nil {
+		booking.AccessToken = auth.BookingToken(bookingAccessKey(), reference)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -769,22 +1051,48 @@ func createBooking(w http.ResponseWriter, r *http.Request) {
 
 // Add getBooking handler
 func getBooking(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	bookingID := vars["id"]
+	bookingID, ok := authorizeBooking(w, r)
+	if !ok {
+		return
+	}
 
-	log.Printf("Fetching booking details for ID: %s", bookingID)
+	log.Printf("Fetching booking details for ID: %d", bookingID)
 
 	var booking Booking
 	err := dbConn.QueryRow(`
-		SELECT id, show_id, user_name, user_email, total_amount, booking_time, status
-		FROM bookings 
-		WHERE id = ?
-	`, bookingID).Scan(&booking.ID, &booking.ShowID, &booking.UserName, &booking.UserEmail, &booking.TotalAmount, &booking.BookingTime, &booking.Status)
+		SELECT b.id, b.reference, b.show_id, b.user_name, b.user_email, b.total_amount, COALESCE(b.currency, ''), b.booking_time, b.status, b.voucher_amount,
+			COALESCE(b.pickup_code, ''), exchanged_from.original_booking_id, exchanged_to.new_booking_id
+		FROM bookings b
+		LEFT JOIN booking_exchanges exchanged_from ON exchanged_from.new_booking_id = b.id
+		LEFT JOIN booking_exchanges exchanged_to ON exchanged_to.original_booking_id = b.id
+		WHERE b.id = ?
+	`, bookingID).Scan(&booking.ID, &booking.Reference, &booking.ShowID, &booking.UserName, &booking.UserEmail, &booking.TotalAmount, &booking.Currency, &booking.BookingTime, &booking.Status, &booking.VoucherAmount,
+		&booking.PickupCode, &booking.ExchangedFrom, &booking.ExchangedTo)
 	if err != nil {
 		log.Printf("Error fetching booking: %v", err)
 		http.Error(w, "Booking not found", http.StatusNotFound)
 		return
 	}
+	booking.BookingTime = inCinemaTime(booking.BookingTime)
+	if booking.Currency == "" {
+		booking.Currency = cinemaCurrency()
+	}
+	booking.TotalAmount.Currency = booking.Currency
+	booking.VoucherAmount.Currency = booking.Currency
+
+	booking.Items, err = bookingItems(dbConn, bookingID)
+	if err != nil {
+		log.Printf("Error fetching items for booking: %v", err)
+		http.Error(w, "Error fetching booking", http.StatusInternalServerError)
+		return
+	}
+
+	booking.Concessions, err = bookingConcessions(dbConn, bookingID)
+	if err != nil {
+		log.Printf("Error fetching concessions for booking: %v", err)
+		http.Error(w, "Error fetching booking", http.StatusInternalServerError)
+		return
+	}
 
 	// Get seat IDs for this booking
 	rows, err := dbConn.Query("SELECT id FROM seats WHERE booking_id = ?", bookingID)
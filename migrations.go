@@ -0,0 +1,397 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// MySQL error numbers returned when a schema change has already been applied.
+const (
+	errDuplicateColumn = 1060
+	errDuplicateKey    = 1061
+)
+
+// Schema changes made after the original tables were created. Every entry
+// must be safe to run again on startup.
+var migrations = []struct {
+	name string
+	stmt string
+}{
+	{
+		name: "create schema_migrations",
+		stmt: `CREATE TABLE IF NOT EXISTS schema_migrations (
+			name VARCHAR(255) PRIMARY KEY,
+			applied_at DATETIME NOT NULL
+		)`,
+	},
+	{
+		name: "add enforce_seat_gaps to shows",
+		stmt: `ALTER TABLE shows ADD COLUMN enforce_seat_gaps BOOLEAN NOT NULL DEFAULT TRUE`,
+	},
+	{
+		name: "add category and accessible to seats",
+		stmt: `ALTER TABLE seats
+			ADD COLUMN category VARCHAR(20) NOT NULL DEFAULT 'standard',
+			ADD COLUMN accessible BOOLEAN NOT NULL DEFAULT FALSE`,
+	},
+	{
+		name: "add seat holds",
+		stmt: `ALTER TABLE seats
+			ADD COLUMN hold_token VARCHAR(64) NULL,
+			ADD COLUMN held_until DATETIME NULL`,
+	},
+	{
+		name: "index seats by show and status",
+		stmt: `CREATE INDEX idx_seats_show_status ON seats (show_id, status)`,
+	},
+	{
+		name: "add status to shows",
+		stmt: `ALTER TABLE shows
+			ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'scheduled',
+			ADD COLUMN cancelled_at DATETIME NULL,
+			ADD COLUMN cancellation_reason VARCHAR(255) NULL`,
+	},
+	{
+		name: "create refunds",
+		stmt: `CREATE TABLE IF NOT EXISTS refunds (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			booking_id INT NOT NULL,
+			amount DECIMAL(10,2) NOT NULL,
+			reason VARCHAR(255),
+			status VARCHAR(20) NOT NULL DEFAULT 'pending',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+			CONSTRAINT fk_refunds_booking_id FOREIGN KEY (booking_id) REFERENCES bookings(id)
+		)`,
+	},
+	{
+		name: "create waitlist_entries",
+		stmt: `CREATE TABLE IF NOT EXISTS waitlist_entries (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			show_id INT NOT NULL,
+			user_name VARCHAR(255),
+			user_email VARCHAR(255) NOT NULL,
+			party_size INT NOT NULL,
+			status VARCHAR(20) NOT NULL DEFAULT 'waiting',
+			claim_token VARCHAR(64) NULL,
+			offer_expires_at DATETIME NULL,
+			booking_id INT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+			INDEX idx_waitlist_show_status (show_id, status, id),
+			UNIQUE KEY uq_waitlist_claim_token (claim_token),
+			CONSTRAINT fk_waitlist_show_id FOREIGN KEY (show_id) REFERENCES shows(id)
+		)`,
+	},
+	{
+		name: "create booking_exchanges",
+		stmt: `CREATE TABLE IF NOT EXISTS booking_exchanges (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			original_booking_id INT NOT NULL,
+			new_booking_id INT NOT NULL,
+			price_difference DECIMAL(10,2) NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE KEY uq_exchanges_original (original_booking_id),
+			UNIQUE KEY uq_exchanges_new (new_booking_id),
+			CONSTRAINT fk_exchanges_original_booking_id FOREIGN KEY (original_booking_id) REFERENCES bookings(id),
+			CONSTRAINT fk_exchanges_new_booking_id FOREIGN KEY (new_booking_id) REFERENCES bookings(id)
+		)`,
+	},
+	{
+		name: "create booking_reminders",
+		stmt: `CREATE TABLE IF NOT EXISTS booking_reminders (
+			booking_id INT PRIMARY KEY,
+			sent_at DATETIME NOT NULL,
+			CONSTRAINT fk_reminders_booking_id FOREIGN KEY (booking_id) REFERENCES bookings(id)
+		)`,
+	},
+	{
+		name: "track reminder claims separately from sends",
+		stmt: `ALTER TABLE booking_reminders ADD COLUMN claimed_at DATETIME NULL, MODIFY sent_at DATETIME NULL`,
+	},
+	{
+		name: "add admitted_at to seats",
+		stmt: `ALTER TABLE seats ADD COLUMN admitted_at DATETIME NULL`,
+	},
+	{
+		name: "add reference to bookings",
+		stmt: `ALTER TABLE bookings ADD COLUMN reference CHAR(8) NULL`,
+	},
+	{
+		name: "add unique index on bookings.reference",
+		stmt: `CREATE UNIQUE INDEX uq_bookings_reference ON bookings (reference)`,
+	},
+	{
+		name: "create users",
+		stmt: `CREATE TABLE IF NOT EXISTS users (
+			id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+			created_at DATETIME NULL,
+			updated_at DATETIME NULL,
+			deleted_at DATETIME NULL,
+			email VARCHAR(255) NOT NULL,
+			password VARCHAR(255) NOT NULL,
+			name VARCHAR(255),
+			UNIQUE KEY uq_users_email (email)
+		)`,
+	},
+	{
+		name: "create sessions",
+		stmt: `CREATE TABLE IF NOT EXISTS sessions (
+			token_hash CHAR(64) PRIMARY KEY,
+			user_id INT UNSIGNED NOT NULL,
+			expires_at DATETIME NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			INDEX idx_sessions_user (user_id),
+			CONSTRAINT fk_sessions_user_id FOREIGN KEY (user_id) REFERENCES users(id)
+		)`,
+	},
+	{
+		name: "add user_id to bookings",
+		stmt: `ALTER TABLE bookings ADD COLUMN user_id INT UNSIGNED NULL`,
+	},
+	{
+		name: "index bookings by user",
+		stmt: `CREATE INDEX idx_bookings_user ON bookings (user_id)`,
+	},
+	{
+		name: "add role to users",
+		stmt: `ALTER TABLE users ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'customer'`,
+	},
+	{
+		name: "create tills",
+		stmt: `CREATE TABLE IF NOT EXISTS tills (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			user_id INT UNSIGNED NOT NULL,
+			opening_float DECIMAL(10,2) NOT NULL,
+			opened_at DATETIME NOT NULL,
+			closed_at DATETIME NULL,
+			counted_cash DECIMAL(10,2) NULL,
+			notes VARCHAR(255),
+			INDEX idx_tills_user (user_id, closed_at),
+			CONSTRAINT fk_tills_user_id FOREIGN KEY (user_id) REFERENCES users(id)
+		)`,
+	},
+	{
+		name: "add sales channel to bookings",
+		stmt: `ALTER TABLE bookings
+			ADD COLUMN channel VARCHAR(20) NOT NULL DEFAULT 'web',
+			ADD COLUMN sold_by INT UNSIGNED NULL,
+			ADD COLUMN payment_method VARCHAR(20) NULL,
+			ADD COLUMN till_id INT NULL`,
+	},
+	{
+		name: "index bookings by till",
+		stmt: `CREATE INDEX idx_bookings_till ON bookings (till_id)`,
+	},
+	{
+		name: "add till to refunds",
+		stmt: `ALTER TABLE refunds
+			ADD COLUMN till_id INT NULL,
+			ADD COLUMN method VARCHAR(20) NULL`,
+	},
+	{
+		name: "create vouchers",
+		stmt: `CREATE TABLE IF NOT EXISTS vouchers (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			code CHAR(16) NOT NULL,
+			initial_value DECIMAL(10,2) NOT NULL,
+			balance DECIMAL(10,2) NOT NULL,
+			issued_at DATETIME NOT NULL,
+			expires_at DATETIME NULL,
+			note VARCHAR(255),
+			UNIQUE KEY uq_vouchers_code (code)
+		)`,
+	},
+	{
+		name: "create voucher_transactions",
+		stmt: `CREATE TABLE IF NOT EXISTS voucher_transactions (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			voucher_id INT NOT NULL,
+			booking_id INT NULL,
+			kind VARCHAR(20) NOT NULL,
+			amount DECIMAL(10,2) NOT NULL,
+			balance_after DECIMAL(10,2) NOT NULL,
+			created_at DATETIME NOT NULL,
+			INDEX idx_voucher_transactions_voucher (voucher_id, id),
+			INDEX idx_voucher_transactions_booking (booking_id),
+			CONSTRAINT fk_voucher_transactions_voucher_id FOREIGN KEY (voucher_id) REFERENCES vouchers(id),
+			CONSTRAINT fk_voucher_transactions_booking_id FOREIGN KEY (booking_id) REFERENCES bookings(id)
+		)`,
+	},
+	{
+		name: "add voucher_amount to bookings",
+		stmt: `ALTER TABLE bookings ADD COLUMN voucher_amount DECIMAL(10,2) NOT NULL DEFAULT 0`,
+	},
+	{
+		name: "create concessions",
+		stmt: `CREATE TABLE IF NOT EXISTS concessions (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			name VARCHAR(100) NOT NULL,
+			description VARCHAR(255),
+			category VARCHAR(20) NOT NULL,
+			price DECIMAL(10,2) NOT NULL,
+			stock INT NOT NULL DEFAULT 0,
+			active BOOLEAN NOT NULL DEFAULT TRUE
+		)`,
+	},
+	{
+		name: "create booking_concessions",
+		stmt: `CREATE TABLE IF NOT EXISTS booking_concessions (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			booking_id INT NOT NULL,
+			concession_id INT NOT NULL,
+			name VARCHAR(100) NOT NULL,
+			quantity INT NOT NULL,
+			unit_price DECIMAL(10,2) NOT NULL,
+			INDEX idx_booking_concessions_booking (booking_id),
+			CONSTRAINT fk_booking_concessions_booking_id FOREIGN KEY (booking_id) REFERENCES bookings(id),
+			CONSTRAINT fk_booking_concessions_concession_id FOREIGN KEY (concession_id) REFERENCES concessions(id)
+		)`,
+	},
+	{
+		name: "add concession pickup to bookings",
+		stmt: `ALTER TABLE bookings
+			ADD COLUMN pickup_code CHAR(6) NULL,
+			ADD COLUMN concessions_collected_at DATETIME NULL`,
+	},
+	{
+		name: "add unique index on bookings.pickup_code",
+		stmt: `CREATE UNIQUE INDEX uq_bookings_pickup_code ON bookings (pickup_code)`,
+	},
+	{
+		name: "create booking_items",
+		stmt: `CREATE TABLE IF NOT EXISTS booking_items (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			booking_id INT NOT NULL,
+			kind VARCHAR(20) NOT NULL,
+			description VARCHAR(255) NOT NULL,
+			seat_id INT NULL,
+			concession_id INT NULL,
+			quantity INT NOT NULL DEFAULT 1,
+			unit_amount DECIMAL(10,2) NOT NULL,
+			amount DECIMAL(10,2) NOT NULL,
+			currency CHAR(3) NOT NULL,
+			included BOOLEAN NOT NULL DEFAULT FALSE,
+			created_at DATETIME NOT NULL,
+			INDEX idx_booking_items_booking (booking_id),
+			CONSTRAINT fk_booking_items_booking_id FOREIGN KEY (booking_id) REFERENCES bookings(id)
+		)`,
+	},
+	{
+		name: "add currency to bookings",
+		stmt: `ALTER TABLE bookings ADD COLUMN currency CHAR(3) NULL`,
+	},
+}
+
+// One-off data conversions. Each runs once, in its own transaction, and is
+// recorded in schema_migrations.
+var dataMigrations = []struct {
+	name string
+	run  func(tx *sql.Tx) error
+}{
+	{name: "store show and booking times in UTC", run: convertTimesToUTC},
+	{name: "assign booking references", run: assignBookingReferences},
+	{name: "itemise existing bookings", run: backfillBookingItems},
+}
+
+// Apply the migrations above, ignoring the ones already present
+func migrateDB() {
+	for _, m := range migrations {
+		_, err := dbConn.Exec(m.stmt)
+		if err == nil {
+			continue
+		}
+
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && (mysqlErr.Number == errDuplicateColumn || mysqlErr.Number == errDuplicateKey) {
+			continue
+		}
+		log.Fatalf("Error applying migration %q: %v", m.name, err)
+	}
+
+	for _, m := range dataMigrations {
+		if err := runDataMigration(m.name, m.run); err != nil {
+			log.Fatalf("Error applying migration %q: %v", m.name, err)
+		}
+	}
+
+	log.Println("Database migrations applied")
+
+	if err := checkStoredCurrency(dbConn); err != nil {
+		log.Fatalf("Error checking currency: %v", err)
+	}
+}
+
+// runDataMigration runs a data migration unless it is already recorded
+func runDataMigration(name string, run func(tx *sql.Tx) error) error {
+	tx, err := dbConn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Recording the migration first also stops two instances running it at once
+	result, err := tx.Exec("INSERT IGNORE INTO schema_migrations (name, applied_at) VALUES (?, ?)", name, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return err
+	}
+
+	log.Printf("Running data migration %q", name)
+	if err := run(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// convertTimesToUTC rewrites show and booking times, which used to be stored
+// as wall-clock times in the cinema's time zone, as UTC
+func convertTimesToUTC(tx *sql.Tx) error {
+	columns := []struct{ table, column string }{
+		{"shows", "start_time"},
+		{"shows", "end_time"},
+		{"bookings", "booking_time"},
+	}
+
+	for _, c := range columns {
+		rows, err := tx.Query("SELECT id, " + c.column + " FROM " + c.table)
+		if err != nil {
+			return err
+		}
+
+		converted := make(map[int]time.Time)
+		for rows.Next() {
+			var id int
+			var t time.Time
+			if err := rows.Scan(&id, &t); err != nil {
+				rows.Close()
+				return err
+			}
+			converted[id] = wallClockToUTC(t)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for id, t := range converted {
+			if _, err := tx.Exec("UPDATE "+c.table+" SET "+c.column+" = ? WHERE id = ?", t, id); err != nil {
+				return err
+			}
+		}
+		log.Printf("Converted %s.%s for %d rows", c.table, c.column, len(converted))
+	}
+	return nil
+}
+
+// wallClockToUTC reads the fields of t as a wall-clock time in the cinema's
+// time zone and returns the matching UTC instant
+func wallClockToUTC(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, cinemaLocation).UTC()
+}
@@ -3,6 +3,8 @@ package models
 import (
 	"time"
 
+	"cinemabooking/money"
+
 	"github.com/jinzhu/gorm"
 )
 
@@ -18,13 +20,14 @@ type Movie struct {
 
 type Show struct {
 	gorm.Model
-	MovieID   uint      `json:"movie_id"`
-	Movie     Movie     `json:"movie,omitempty"`
-	StartTime time.Time `json:"start_time"`
-	EndTime   time.Time `json:"end_time"`
-	Screen    string    `json:"screen"`
-	Price     float32   `json:"price"`
-	Seats     []Seat    `json:"seats,omitempty"`
+	MovieID   uint        `json:"movie_id"`
+	Movie     Movie       `json:"movie,omitempty"`
+	StartTime time.Time   `json:"start_time"`
+	EndTime   time.Time   `json:"end_time"`
+	Screen    string      `json:"screen"`
+	Price     money.Money `json:"price" gorm:"type:decimal(10,2)"`
+	Status    string      `json:"status" gorm:"default:'scheduled'"` // scheduled, cancelled
+	Seats     []Seat      `json:"seats,omitempty"`
 }
 
 type Seat struct {
@@ -39,13 +42,32 @@ type Seat struct {
 
 type Booking struct {
 	gorm.Model
-	UserID      uint    `json:"user_id"`
-	ShowID      uint    `json:"show_id"`
-	Show        Show    `json:"show,omitempty"`
-	Seats       []Seat  `json:"seats,omitempty"`
-	TotalAmount float32 `json:"total_amount"`
-	Status      string  `json:"status"` // confirmed, cancelled
-	PaymentID   string  `json:"payment_id"`
+	UserID      uint          `json:"user_id"`
+	ShowID      uint          `json:"show_id"`
+	Show        Show          `json:"show,omitempty"`
+	Seats       []Seat        `json:"seats,omitempty"`
+	TotalAmount money.Money   `json:"total_amount" gorm:"type:decimal(10,2)"`
+	Currency    string        `json:"currency"`
+	Items       []BookingItem `json:"items,omitempty"`
+	Status      string        `json:"status"` // confirmed, cancelled
+	PaymentID   string        `json:"payment_id"`
+}
+
+// BookingItem is one line of what a booking costs: a seat, fee, discount,
+// tax or add-on
+type BookingItem struct {
+	ID           uint        `json:"id"`
+	BookingID    uint        `json:"booking_id"`
+	Kind         string      `json:"kind"` // seat, fee, discount, tax, add_on
+	Description  string      `json:"description"`
+	SeatID       *uint       `json:"seat_id,omitempty"`
+	ConcessionID *uint       `json:"concession_id,omitempty"`
+	Quantity     int         `json:"quantity"`
+	UnitAmount   money.Money `json:"unit_amount" gorm:"type:decimal(10,2)"`
+	Amount       money.Money `json:"amount" gorm:"type:decimal(10,2)"`
+	Currency     string      `json:"currency"`
+	Included     bool        `json:"included"` // already part of other items, e.g. tax in the price
+	CreatedAt    time.Time   `json:"created_at"`
 }
 
 type User struct {
@@ -53,5 +75,6 @@ type User struct {
 	Email    string    `json:"email"`
 	Password string    `json:"-"` // Password hash, not exposed in JSON
 	Name     string    `json:"name"`
+	Role     string    `json:"role" gorm:"default:'customer'"` // customer, box_office, manager, admin
 	Bookings []Booking `json:"bookings,omitempty"`
 }
@@ -0,0 +1,266 @@
+// Package money represents amounts of money exactly, as an integer number of
+// minor units (cents) in a currency.
+//
+// Amounts are stored in DECIMAL(10,2) columns and written to JSON as decimal
+// numbers of major units, e.g. 12.99, so existing clients keep working.
+package money
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Every supported currency has two decimal places
+const minorUnits = 100
+
+// DefaultCurrency is used when no currency is configured.
+const DefaultCurrency = "USD"
+
+// ErrInvalidAmount is returned for strings that aren't a decimal amount.
+var ErrInvalidAmount = errors.New("money: invalid amount")
+
+// Money is an amount in a currency. The zero value is zero in no particular
+// currency and can be added to an amount in any currency.
+type Money struct {
+	Cents    int64
+	Currency string
+}
+
+// ParseCurrency normalises an ISO 4217 currency code such as "gbp", falling
+// back to DefaultCurrency for anything that isn't three letters.
+func ParseCurrency(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if len(code) != 3 || strings.Trim(code, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+		return DefaultCurrency
+	}
+	return code
+}
+
+// New returns an amount of cents in a currency.
+func New(cents int64, currency string) Money {
+	return Money{Cents: cents, Currency: currency}
+}
+
+// FromFloat converts an amount in major units, rounding half away from zero
+// to the nearest cent. Only use it at the edges, for amounts already held as
+// floats.
+func FromFloat(amount float64, currency string) Money {
+	return Money{Cents: int64(math.Round(amount * minorUnits)), Currency: currency}
+}
+
+// Parse reads a decimal amount in major units such as "12.99" or "-3.5"
+// exactly. More than two decimal places is an error.
+func Parse(s, currency string) (Money, error) {
+	s = strings.TrimSpace(s)
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" && frac == "" || len(frac) > 2 {
+		return Money{}, ErrInvalidAmount
+	}
+	if whole == "" {
+		whole = "0"
+	}
+	frac += strings.Repeat("0", 2-len(frac))
+
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || units > math.MaxInt64/minorUnits-1 {
+		return Money{}, ErrInvalidAmount
+	}
+	cents, err := strconv.ParseUint(frac, 10, 8)
+	if err != nil {
+		return Money{}, ErrInvalidAmount
+	}
+
+	m := Money{Cents: units*minorUnits + int64(cents), Currency: currency}
+	if negative {
+		m.Cents = -m.Cents
+	}
+	return m, nil
+}
+
+// currencyOf picks the currency of a sum, panicking if two amounts in
+// different currencies are combined
+func currencyOf(a, b Money) string {
+	switch {
+	case a.Currency == "":
+		return b.Currency
+	case b.Currency == "" || a.Currency == b.Currency:
+		return a.Currency
+	}
+	panic(fmt.Sprintf("money: cannot combine %s and %s", a.Currency, b.Currency))
+}
+
+// Add returns m + o.
+func (m Money) Add(o Money) Money {
+	return Money{Cents: m.Cents + o.Cents, Currency: currencyOf(m, o)}
+}
+
+// Sub returns m - o.
+func (m Money) Sub(o Money) Money {
+	return Money{Cents: m.Cents - o.Cents, Currency: currencyOf(m, o)}
+}
+
+// Mul returns m times a quantity.
+func (m Money) Mul(quantity int) Money {
+	return Money{Cents: m.Cents * int64(quantity), Currency: m.Currency}
+}
+
+// Neg returns -m.
+func (m Money) Neg() Money {
+	return Money{Cents: -m.Cents, Currency: m.Currency}
+}
+
+// Min returns the smaller of m and o.
+func (m Money) Min(o Money) Money {
+	currency := currencyOf(m, o)
+	if o.Cents < m.Cents {
+		m = o
+	}
+	m.Currency = currency
+	return m
+}
+
+// IsZero reports whether m is zero.
+func (m Money) IsZero() bool { return m.Cents == 0 }
+
+// IsNegative reports whether m is below zero.
+func (m Money) IsNegative() bool { return m.Cents < 0 }
+
+// IsPositive reports whether m is above zero.
+func (m Money) IsPositive() bool { return m.Cents > 0 }
+
+// Split divides m into n parts that add back up to m exactly. Leftover cents
+// go to the first parts.
+func (m Money) Split(n int) []Money {
+	if n <= 0 {
+		return nil
+	}
+	parts := make([]Money, n)
+	share, left := m.Cents/int64(n), m.Cents%int64(n)
+	for i := range parts {
+		parts[i] = Money{Cents: share, Currency: m.Currency}
+		switch {
+		case left > 0:
+			parts[i].Cents++
+			left--
+		case left < 0:
+			parts[i].Cents--
+			left++
+		}
+	}
+	return parts
+}
+
+// Sum adds up amounts.
+func Sum(amounts ...Money) Money {
+	var total Money
+	for _, amount := range amounts {
+		total = total.Add(amount)
+	}
+	return total
+}
+
+// Float64 returns m in major units, for code that still works in floats.
+func (m Money) Float64() float64 {
+	return float64(m.Cents) / minorUnits
+}
+
+// String formats m in major units with two decimal places, e.g. "12.99".
+func (m Money) String() string {
+	sign := ""
+	cents := m.Cents
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/minorUnits, cents%minorUnits)
+}
+
+// symbols are the currencies written with a symbol rather than their code
+var symbols = map[string]string{
+	"AUD": "A$",
+	"CAD": "C$",
+	"EUR": "€",
+	"GBP": "£",
+	"USD": "$",
+}
+
+// Format writes m for people to read in its currency, e.g. "$12.99",
+// "-£3.50" or "CHF 12.99". Amounts with no currency are written in the
+// default one.
+func (m Money) Format() string {
+	currency := m.Currency
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+	amount := m.String()
+	sign := ""
+	if m.IsNegative() {
+		sign, amount = "-", amount[1:]
+	}
+	if symbol, ok := symbols[currency]; ok {
+		return sign + symbol + amount
+	}
+	return sign + currency + " " + amount
+}
+
+// MarshalJSON writes m as a decimal number of major units.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON reads a decimal number (or string) of major units. The
+// currency is left as it was.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "null" {
+		return nil
+	}
+	parsed, err := Parse(s, m.Currency)
+	if err != nil {
+		// Clients may send more decimals than needed, e.g. from float maths
+		f, ferr := strconv.ParseFloat(s, 64)
+		if ferr != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+			return err
+		}
+		parsed = FromFloat(f, m.Currency)
+	}
+	*m = parsed
+	return nil
+}
+
+// Value stores m in a DECIMAL column.
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+// Scan reads a DECIMAL column. The currency is left as it was.
+func (m *Money) Scan(src interface{}) error {
+	var parsed Money
+	var err error
+	switch v := src.(type) {
+	case []byte:
+		parsed, err = Parse(string(v), m.Currency)
+	case string:
+		parsed, err = Parse(v, m.Currency)
+	case int64:
+		parsed = Money{Cents: v * minorUnits, Currency: m.Currency}
+	case float64:
+		parsed = FromFloat(v, m.Currency)
+	case nil:
+		parsed = Money{Currency: m.Currency}
+	default:
+		return fmt.Errorf("money: cannot scan %T", src)
+	}
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"cinemabooking/cinematime"
+	"cinemabooking/pagination"
+)
+
+// Page sizes for /api/movies/all
+const (
+	defaultMoviePageSize = 50
+	maxMoviePageSize     = 100
+)
+
+// Columns movies can be sorted by. Every sort breaks ties on the movie ID so
+// pages are stable; next_showtime sorts movies with no upcoming show last.
+var movieSortColumns = map[string]struct {
+	expr     string
+	nullable bool
+}{
+	"title":         {expr: "title", nullable: false},
+	"rating":        {expr: "rating", nullable: false},
+	"next_showtime": {expr: "next_showtime", nullable: true},
+}
+
+// movieQuery is a parsed /api/movies/all request
+type movieQuery struct {
+	search      string
+	ratings     []string
+	minDuration int
+	maxDuration int
+	showingFrom *time.Time
+	showingTo   *time.Time
+	sort        string
+	limit       int
+	cursor      *pagination.Cursor
+}
+
+// parseMovieQuery validates the search, filter, sort and paging parameters
+func parseMovieQuery(values url.Values) (movieQuery, error) {
+	q := movieQuery{
+		search: strings.TrimSpace(values.Get("q")),
+		sort:   "title",
+		limit:  defaultMoviePageSize,
+	}
+
+	if rating := values.Get("rating"); rating != "" {
+		for _, r := range strings.Split(rating, ",") {
+			if r = strings.TrimSpace(r); r != "" {
+				q.ratings = append(q.ratings, r)
+			}
+		}
+	}
+
+	var err error
+	if v := values.Get("min_duration"); v != "" {
+		if q.minDuration, err = strconv.Atoi(v); err != nil || q.minDuration < 0 {
+			return q, errors.New("min_duration must be a positive number of minutes")
+		}
+	}
+	if v := values.Get("max_duration"); v != "" {
+		if q.maxDuration, err = strconv.Atoi(v); err != nil || q.maxDuration < 0 {
+			return q, errors.New("max_duration must be a positive number of minutes")
+		}
+	}
+
+	if v := values.Get("date"); v != "" {
+		dayStart, dayEnd, err := cinematime.DayBounds(v, cinemaLocation)
+		if err != nil {
+			return q, err
+		}
+		q.showingFrom, q.showingTo = &dayStart, &dayEnd
+	}
+
+	if v := values.Get("sort"); v != "" {
+		if _, ok := movieSortColumns[v]; !ok {
+			return q, errors.New("sort must be one of title, rating, next_showtime")
+		}
+		q.sort = v
+	}
+
+	if v := values.Get("limit"); v != "" {
+		if q.limit, err = strconv.Atoi(v); err != nil || q.limit < 1 || q.limit > maxMoviePageSize {
+			return q, errors.New("limit must be between 1 and " + strconv.Itoa(maxMoviePageSize))
+		}
+	}
+
+	if v := values.Get("cursor"); v != "" {
+		cursor, err := pagination.Decode(v, q.sort)
+		if err != nil {
+			return q, err
+		}
+		q.cursor = &cursor
+	}
+
+	return q, nil
+}
+
+// sql builds the listing query. One extra row is fetched to tell whether
+// there is a next page.
+func (q movieQuery) sql(now time.Time) (string, []interface{}) {
+	var where []string
+	var args []interface{}
+
+	// The next showtime is computed first so it can be filtered and sorted on
+	inner := `
+		SELECT m.id, m.title, COALESCE(m.description, '') AS description, m.duration,
+			COALESCE(m.rating, '') AS rating, COALESCE(m.poster_url, '') AS poster_url,
+			(SELECT MIN(s.start_time) FROM shows s WHERE s.movie_id = m.id AND s.start_time >= ? AND s.status != 'cancelled') AS next_showtime
+		FROM movies m`
+	args = append(args, now)
+
+	if q.search != "" {
+		where = append(where, "title LIKE ?")
+		args = append(args, "%"+escapeLike(q.search)+"%")
+	}
+	if len(q.ratings) > 0 {
+		where = append(where, "rating IN (?"+strings.Repeat(", ?", len(q.ratings)-1)+")")
+		for _, r := range q.ratings {
+			args = append(args, r)
+		}
+	}
+	if q.minDuration > 0 {
+		where = append(where, "duration >= ?")
+		args = append(args, q.minDuration)
+	}
+	if q.maxDuration > 0 {
+		where = append(where, "duration <= ?")
+		args = append(args, q.maxDuration)
+	}
+	if q.showingFrom != nil {
+		where = append(where, "EXISTS (SELECT 1 FROM shows s WHERE s.movie_id = movie_list.id AND s.start_time >= ? AND s.start_time < ? AND s.status != 'cancelled')")
+		args = append(args, *q.showingFrom, *q.showingTo)
+	}
+
+	column := movieSortColumns[q.sort]
+	if q.cursor != nil {
+		cond, condArgs := keysetCondition(column.expr, column.nullable, *q.cursor)
+		where = append(where, cond)
+		args = append(args, condArgs...)
+	}
+
+	query := "SELECT id, title, description, duration, rating, poster_url, next_showtime FROM (" + inner + ") AS movie_list"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	if column.nullable {
+		query += " ORDER BY " + column.expr + " IS NULL, " + column.expr + ", id"
+	} else {
+		query += " ORDER BY " + column.expr + ", id"
+	}
+	query += " LIMIT ?"
+	args = append(args, q.limit+1)
+
+	return query, args
+}
+
+// keysetCondition selects the rows after the cursor in (expr, id) order, with
+// NULLs sorted last
+func keysetCondition(expr string, nullable bool, c pagination.Cursor) (string, []interface{}) {
+	if c.Key == nil {
+		return "(" + expr + " IS NULL AND id > ?)", []interface{}{c.ID}
+	}
+	cond := "(" + expr + " > ? OR (" + expr + " = ? AND id > ?))"
+	if nullable {
+		cond = "(" + expr + " IS NULL OR " + expr + " > ? OR (" + expr + " = ? AND id > ?))"
+	}
+	return cond, []interface{}{*c.Key, *c.Key, c.ID}
+}
+
+// escapeLike escapes the LIKE wildcards in user input
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,39 @@
+// Package notifications sends emails to customers.
+package notifications
+
+import "log"
+
+// Message is a single email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+	// Done, if set, is called once with the outcome of delivering the
+	// message: nil once it is sent, or the error it was given up with. A
+	// Queue calls it after its retries; other mailers before Send returns.
+	Done func(err error)
+}
+
+// report passes the outcome of delivering a message to its Done callback and
+// returns it
+func (m Message) report(err error) error {
+	if m.Done != nil {
+		m.Done(err)
+	}
+	return err
+}
+
+// Mailer delivers messages. Implementations decide how: over SMTP, to a
+// local outbox, or just to the log.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// LogMailer writes messages to the application log instead of sending them.
+type LogMailer struct{}
+
+// Send implements Mailer.
+func (LogMailer) Send(msg Message) error {
+	log.Printf("Email to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return msg.report(nil)
+}
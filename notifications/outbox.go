@@ -0,0 +1,28 @@
+package notifications
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// OutboxMailer writes each message to a file in Dir instead of sending it, so
+// emails can be read during local development.
+type OutboxMailer struct {
+	Dir  string
+	From string
+}
+
+// Distinguishes messages written in the same nanosecond
+var outboxSeq atomic.Uint64
+
+// Send implements Mailer.
+func (m OutboxMailer) Send(msg Message) error {
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return msg.report(err)
+	}
+	name := fmt.Sprintf("%s-%d.eml", time.Now().UTC().Format("20060102T150405.000000000"), outboxSeq.Add(1))
+	return msg.report(os.WriteFile(filepath.Join(m.Dir, name), encode(m.From, msg), 0o644))
+}
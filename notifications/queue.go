@@ -0,0 +1,110 @@
+package notifications
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// Errors returned when a message can't be queued
+var (
+	ErrQueueFull   = errors.New("notifications: send queue is full")
+	ErrQueueClosed = errors.New("notifications: send queue is closed")
+)
+
+// Queue sends messages in the background through another Mailer, retrying
+// failed sends with exponential backoff. It is itself a Mailer, so callers
+// don't wait on the mail server.
+type Queue struct {
+	mailer      Mailer
+	maxAttempts int
+	backoff     time.Duration
+
+	mu     sync.RWMutex
+	closed bool
+	jobs   chan Message
+	wg     sync.WaitGroup
+}
+
+// NewQueue starts workers that deliver queued messages through mailer. Each
+// message is tried up to maxAttempts times, waiting backoff, 2*backoff, ...
+// between attempts.
+func NewQueue(mailer Mailer, size, workers, maxAttempts int, backoff time.Duration) *Queue {
+	if workers < 1 {
+		workers = 1
+	}
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	q := &Queue{
+		mailer:      mailer,
+		maxAttempts: maxAttempts,
+		backoff:     backoff,
+		jobs:        make(chan Message, size),
+	}
+	for i := 0; i < workers; i++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+	return q
+}
+
+// Send queues a message without blocking. It fails if the queue is full or
+// closed.
+func (q *Queue) Send(msg Message) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return msg.report(ErrQueueClosed)
+	}
+	select {
+	case q.jobs <- msg:
+		return nil
+	default:
+		return msg.report(ErrQueueFull)
+	}
+}
+
+// Close stops accepting messages and waits for the queued ones to be sent.
+func (q *Queue) Close() {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.jobs)
+	}
+	q.mu.Unlock()
+	q.wg.Wait()
+}
+
+func (q *Queue) work() {
+	defer q.wg.Done()
+	for msg := range q.jobs {
+		q.deliver(msg)
+	}
+}
+
+// deliver sends one message, retrying until it succeeds or runs out of
+// attempts, and then reports the outcome
+func (q *Queue) deliver(msg Message) {
+	// Only the final outcome is reported, not each attempt
+	attemptMsg := msg
+	attemptMsg.Done = nil
+
+	wait := q.backoff
+	for attempt := 1; ; attempt++ {
+		err := q.mailer.Send(attemptMsg)
+		if err == nil {
+			msg.report(nil)
+			return
+		}
+		if attempt >= q.maxAttempts {
+			log.Printf("Giving up emailing %s (%q) after %d attempts: %v", msg.To, msg.Subject, attempt, err)
+			msg.report(err)
+			return
+		}
+		log.Printf("Error emailing %s (attempt %d), retrying in %s: %v", msg.To, attempt, wait, err)
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
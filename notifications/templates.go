@@ -0,0 +1,150 @@
+package notifications
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"cinemabooking/money"
+)
+
+// Booking holds what the customer emails say about a booking. StartTime
+// should already be in the cinema's time zone.
+type Booking struct {
+	ID         int
+	Reference  string
+	Name       string
+	Email      string
+	MovieTitle string
+	Screen     string
+	StartTime  time.Time
+	Seats      []string
+	Total      money.Money
+	// Food and drink to collect, e.g. "2 x Large Popcorn", and the code to
+	// collect it with
+	Extras     []string
+	PickupCode string
+	// Where the customer can view the booking
+	Link string
+}
+
+// Greeting is the name to address the customer by.
+func (b Booking) Greeting() string {
+	return greeting(b.Name)
+}
+
+// WaitlistOffer holds what the email offering seats to a customer on a
+// show's waitlist says. Times should already be in the cinema's time zone.
+type WaitlistOffer struct {
+	Name       string
+	Email      string
+	MovieTitle string
+	Screen     string
+	StartTime  time.Time
+	Seats      []string
+	// Where the customer claims the seats, and when the offer runs out
+	Link    string
+	Expires time.Time
+}
+
+// Greeting is the name to address the customer by.
+func (o WaitlistOffer) Greeting() string {
+	return greeting(o.Name)
+}
+
+func greeting(name string) string {
+	if name == "" {
+		return "there"
+	}
+	return name
+}
+
+var templateFuncs = template.FuncMap{
+	"when":  func(t time.Time) string { return t.Format("Monday 2 January 2006 at 15:04 MST") },
+	"money": money.Money.Format,
+	"join":  strings.Join,
+}
+
+var (
+	confirmationTemplate = template.Must(template.New("confirmation").Funcs(templateFuncs).Parse(
+		`Hi {{.Greeting}},
+
+Your booking {{.Reference}} is confirmed.
+
+{{.MovieTitle}}
+{{when .StartTime}}, {{.Screen}}
+Seats: {{join .Seats ", "}}
+{{if .PickupCode}}Food and drink: {{join .Extras ", "}}
+Collect it from the concessions stand with pickup code {{.PickupCode}}
+{{end}}Total: {{money .Total}}
+{{if .Link}}
+View your booking and tickets: {{.Link}}
+{{end}}
+Enjoy the show!
+`))
+
+	cancellationTemplate = template.Must(template.New("cancellation").Funcs(templateFuncs).Parse(
+		`Hi {{.Greeting}},
+
+Unfortunately {{.MovieTitle}} on {{when .StartTime}} has been cancelled ({{.Reason}}).
+Your booking {{.Reference}} is cancelled and a full refund of {{money .Refund}} is on its way.
+
+We're sorry for the inconvenience.
+`))
+
+	reminderTemplate = template.Must(template.New("reminder").Funcs(templateFuncs).Parse(
+		`Hi {{.Greeting}},
+
+This is a reminder that {{.MovieTitle}} starts {{when .StartTime}} in {{.Screen}}.
+{{if .Seats}}Your seats: {{join .Seats ", "}}
+{{end}}Booking reference: {{.Reference}}
+
+See you soon!
+`))
+
+	waitlistOfferTemplate = template.Must(template.New("waitlist_offer").Funcs(templateFuncs).Parse(
+		`Hi {{.Greeting}},
+
+Seats have become available for {{.MovieTitle}} on {{when .StartTime}}, {{.Screen}}.
+We're holding {{join .Seats ", "}} for you until {{.Expires.Format "15:04"}}.
+
+Book them here: {{.Link}}
+
+If you don't book them by then they'll be offered to the next person waiting.
+`))
+)
+
+// BookingConfirmation is sent when a booking is made.
+func BookingConfirmation(b Booking) (Message, error) {
+	return render(b.Email, fmt.Sprintf("Booking %s confirmed: %s", b.Reference, b.MovieTitle), confirmationTemplate, b)
+}
+
+// BookingCancellation is sent when a booking is cancelled because its show was.
+func BookingCancellation(b Booking, reason string, refund money.Money) (Message, error) {
+	data := struct {
+		Booking
+		Reason string
+		Refund money.Money
+	}{b, reason, refund}
+	return render(b.Email, fmt.Sprintf("Your booking %s has been cancelled", b.Reference), cancellationTemplate, data)
+}
+
+// ShowReminder is sent shortly before the show.
+func ShowReminder(b Booking) (Message, error) {
+	return render(b.Email, fmt.Sprintf("Reminder: %s at %s", b.MovieTitle, b.StartTime.Format("15:04")), reminderTemplate, b)
+}
+
+// WaitlistSeatsOffered is sent when seats are held for a customer on the
+// waitlist.
+func WaitlistSeatsOffered(o WaitlistOffer) (Message, error) {
+	return render(o.Email, fmt.Sprintf("Seats available: %s", o.MovieTitle), waitlistOfferTemplate, o)
+}
+
+func render(to, subject string, tmpl *template.Template, data interface{}) (Message, error) {
+	var body strings.Builder
+	if err := tmpl.Execute(&body, data); err != nil {
+		return Message{}, err
+	}
+	return Message{To: to, Subject: subject, Body: body.String()}, nil
+}
@@ -0,0 +1,43 @@
+// Package pagination encodes the opaque cursors used for keyset pagination
+// of API listings.
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+// ErrInvalidCursor is returned when a cursor can't be decoded.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor marks the last row of a page: the value of the sort column (nil when
+// the column was NULL) and the row ID that breaks ties.
+type Cursor struct {
+	Sort string  `json:"s"`
+	Key  *string `json:"k"`
+	ID   int     `json:"id"`
+}
+
+// Encode returns the cursor as a URL-safe string.
+func (c Cursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Decode parses a cursor produced by Encode. The cursor must have been issued
+// for the same sort order it is used with.
+func Decode(s, sort string) (Cursor, error) {
+	var c Cursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, ErrInvalidCursor
+	}
+	if c.Sort != sort || c.ID <= 0 {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
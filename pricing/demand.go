@@ -0,0 +1,172 @@
+package pricing
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"cinemabooking/money"
+)
+
+// Demand is what a show's ticket price depends on besides its base price.
+type Demand struct {
+	// Percentage of seats booked or held
+	Occupancy float64
+	// When the show starts, in the cinema's time zone
+	Start time.Time
+	// When the price is asked for
+	At time.Time
+}
+
+// Occupancy is the percentage of a show's seats that are taken.
+func Occupancy(seats, taken int) float64 {
+	if seats <= 0 {
+		return 0
+	}
+	return float64(taken) / float64(seats) * 100
+}
+
+// HoursBefore is how long before the show starts the price is asked for.
+func (d Demand) HoursBefore() float64 {
+	return d.Start.Sub(d.At).Hours()
+}
+
+// Adjustment changes the ticket price of shows that meet all its conditions.
+// Conditions left out always hold.
+type Adjustment struct {
+	Name string `json:"name"`
+	// Percentage of seats taken: at least, and below
+	OccupancyFrom  *float64 `json:"occupancy_from,omitempty"`
+	OccupancyBelow *float64 `json:"occupancy_below,omitempty"`
+	// Hours until the show starts: at least, and below
+	HoursBeforeFrom  *float64 `json:"hours_before_from,omitempty"`
+	HoursBeforeBelow *float64 `json:"hours_before_below,omitempty"`
+	// Days the show starts on, e.g. "Tuesday" or "tue"
+	Days []string `json:"days,omitempty"`
+	// Window the show starts in as "15:04", e.g. 10:00 to 17:00 for matinees
+	StartsFrom   string `json:"starts_from,omitempty"`
+	StartsBefore string `json:"starts_before,omitempty"`
+	// Change to the base price as a percentage, e.g. 15 or -20, and as an
+	// amount
+	Percent float64     `json:"percent,omitempty"`
+	Amount  money.Money `json:"amount"`
+}
+
+// Applies reports whether a show's demand meets the adjustment's conditions.
+func (a Adjustment) Applies(d Demand) bool {
+	occupancy, hours := d.Occupancy, d.HoursBefore()
+	if a.OccupancyFrom != nil && occupancy < *a.OccupancyFrom {
+		return false
+	}
+	if a.OccupancyBelow != nil && occupancy >= *a.OccupancyBelow {
+		return false
+	}
+	if a.HoursBeforeFrom != nil && hours < *a.HoursBeforeFrom {
+		return false
+	}
+	if a.HoursBeforeBelow != nil && hours >= *a.HoursBeforeBelow {
+		return false
+	}
+	if len(a.Days) > 0 && !a.onDay(d.Start.Weekday()) {
+		return false
+	}
+
+	// Validated rules always parse
+	start := d.Start.Hour()*60 + d.Start.Minute()
+	if from, ok := minuteOfDay(a.StartsFrom); ok && start < from {
+		return false
+	}
+	if before, ok := minuteOfDay(a.StartsBefore); ok && start >= before {
+		return false
+	}
+	return true
+}
+
+func (a Adjustment) onDay(day time.Weekday) bool {
+	for _, name := range a.Days {
+		if d, ok := weekday(name); ok && d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// ShowPrice adjusts a show's base ticket price by every adjustment that
+// applies to its demand, and returns the price with those adjustments. The
+// percentages are added together and taken of the base price, so the order
+// of the adjustments doesn't matter. The price is never below zero.
+func (r Rules) ShowPrice(base money.Money, d Demand) (money.Money, []Adjustment) {
+	var applied []Adjustment
+	var basisPoints int64
+	change := money.New(0, base.Currency)
+	for _, adjustment := range r.Adjustments {
+		if !adjustment.Applies(d) {
+			continue
+		}
+		applied = append(applied, adjustment)
+		basisPoints += int64(math.Round(adjustment.Percent * 100))
+		change = change.Add(adjustment.Amount)
+	}
+
+	price := base.Add(money.New(divide(base.Cents*basisPoints, 10000, HalfUp), base.Currency)).Add(change)
+	if price.IsNegative() {
+		price = money.New(0, base.Currency)
+	}
+	return price, applied
+}
+
+// validate checks an adjustment can be applied
+func (a Adjustment) validate() error {
+	if a.Name == "" {
+		return fmt.Errorf("%w: adjustment without a name", ErrInvalidRules)
+	}
+	for _, bound := range []*float64{a.OccupancyFrom, a.OccupancyBelow} {
+		if bound != nil && (*bound < 0 || *bound > 100 || math.IsNaN(*bound)) {
+			return fmt.Errorf("%w: adjustment %q occupancy must be between 0 and 100", ErrInvalidRules, a.Name)
+		}
+	}
+	for _, bound := range []*float64{a.HoursBeforeFrom, a.HoursBeforeBelow} {
+		if bound != nil && math.IsNaN(*bound) {
+			return fmt.Errorf("%w: adjustment %q has an invalid number of hours", ErrInvalidRules, a.Name)
+		}
+	}
+	for _, day := range a.Days {
+		if _, ok := weekday(day); !ok {
+			return fmt.Errorf("%w: adjustment %q has unknown day %q", ErrInvalidRules, a.Name, day)
+		}
+	}
+	for _, clock := range []string{a.StartsFrom, a.StartsBefore} {
+		if _, ok := minuteOfDay(clock); clock != "" && !ok {
+			return fmt.Errorf("%w: adjustment %q start time %q must be HH:MM", ErrInvalidRules, a.Name, clock)
+		}
+	}
+	if a.Percent < -100 || math.IsNaN(a.Percent) || math.IsInf(a.Percent, 0) {
+		return fmt.Errorf("%w: adjustment %q can't take off more than 100%%", ErrInvalidRules, a.Name)
+	}
+	return nil
+}
+
+// weekday parses a day's full English name or its first three letters
+func weekday(name string) (time.Weekday, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if len(name) < 3 {
+		return 0, false
+	}
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		full := strings.ToLower(day.String())
+		if name == full || name == full[:3] {
+			return day, true
+		}
+	}
+	return 0, false
+}
+
+// minuteOfDay parses "15:04" into minutes after midnight
+func minuteOfDay(clock string) (int, bool) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, false
+	}
+	return t.Hour()*60 + t.Minute(), true
+}
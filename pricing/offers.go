@@ -0,0 +1,77 @@
+package pricing
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"cinemabooking/money"
+)
+
+// Prefix of every signed offer, versioning the format
+const offerPrefix = "PO1"
+
+// ErrInvalidOffer is returned for offers that are malformed or whose
+// signature doesn't match.
+var ErrInvalidOffer = errors.New("pricing: invalid offer")
+
+// Offer is a ticket price shown to a customer, honoured until it expires
+// even if demand has raised the price since.
+type Offer struct {
+	ShowID  int         `json:"s"`
+	Price   money.Money `json:"p"`
+	Expires time.Time   `json:"e"`
+}
+
+// offerPayload is an offer as signed; money marshals without its currency
+type offerPayload struct {
+	Offer
+	Currency string `json:"c"`
+}
+
+// SignOffer encodes an offer as "PO1.<payload>.<signature>", both parts
+// unpadded base64url, the signature an HMAC-SHA256 of the first two parts.
+func SignOffer(o Offer, key []byte) (string, error) {
+	data, err := json.Marshal(offerPayload{o, o.Price.Currency})
+	if err != nil {
+		return "", err
+	}
+	signed := offerPrefix + "." + base64.RawURLEncoding.EncodeToString(data)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(offerMAC(signed, key)), nil
+}
+
+// VerifyOffer checks an offer's signature and that it hasn't expired at now,
+// and returns the offer.
+func VerifyOffer(token string, key []byte, now time.Time) (Offer, error) {
+	i := strings.LastIndexByte(token, '.')
+	if i < 0 || !strings.HasPrefix(token, offerPrefix+".") {
+		return Offer{}, ErrInvalidOffer
+	}
+	signed, sig := token[:i], token[i+1:]
+
+	given, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(given, offerMAC(signed, key)) {
+		return Offer{}, ErrInvalidOffer
+	}
+
+	var p offerPayload
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(signed, offerPrefix+"."))
+	if err != nil || json.Unmarshal(data, &p) != nil {
+		return Offer{}, ErrInvalidOffer
+	}
+	if !now.Before(p.Expires) {
+		return Offer{}, ErrInvalidOffer
+	}
+	p.Price.Currency = p.Currency
+	return p.Offer, nil
+}
+
+func offerMAC(signed string, key []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(signed))
+	return h.Sum(nil)
+}
@@ -0,0 +1,268 @@
+// Package pricing works out what a booking costs: it adjusts a show's ticket
+// price to demand, and adds the booking fees for the sales channel and the
+// taxes of the jurisdiction to the seats and add-ons being bought.
+package pricing
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"cinemabooking/money"
+)
+
+// Sales channels
+const (
+	Web       = "web"
+	BoxOffice = "box_office"
+)
+
+// Kinds of item
+const (
+	KindSeat     = "seat"
+	KindFee      = "fee"
+	KindDiscount = "discount"
+	KindTax      = "tax"
+	KindAddOn    = "add_on"
+)
+
+// Item is one line of what a booking costs.
+type Item struct {
+	Kind         string      `json:"kind"`
+	Description  string      `json:"description"`
+	SeatID       *int        `json:"seat_id,omitempty"`
+	ConcessionID *int        `json:"concession_id,omitempty"`
+	Quantity     int         `json:"quantity"`
+	UnitAmount   money.Money `json:"unit_amount"`
+	Amount       money.Money `json:"amount"`
+	// Included items, such as tax already in the prices, are listed for the
+	// record but not added to the total
+	Included bool `json:"included,omitempty"`
+}
+
+// Total adds up the items that count towards the total.
+func Total(items []Item) money.Money {
+	var total money.Money
+	for _, item := range items {
+		if !item.Included {
+			total = total.Add(item.Amount)
+		}
+	}
+	return total
+}
+
+// Rounding is how a tax amount is rounded to whole cents.
+type Rounding string
+
+// Rounding modes
+const (
+	HalfUp   Rounding = "half_up"   // 0.5 cents and up round away from zero
+	HalfEven Rounding = "half_even" // 0.5 cents round to the even cent
+	Down     Rounding = "down"      // towards zero
+	Up       Rounding = "up"        // away from zero
+)
+
+// Fee is a booking fee charged on one channel, or all of them.
+type Fee struct {
+	Name string `json:"name"`
+	// Empty for every channel
+	Channel string `json:"channel,omitempty"`
+	// Charged for each ticket, and once for each booking
+	PerTicket  money.Money `json:"per_ticket"`
+	PerBooking money.Money `json:"per_booking"`
+}
+
+// Tax is a tax on the items of a booking.
+type Tax struct {
+	Name string `json:"name"`
+	// Percentage, e.g. 20 for 20%
+	Rate float64 `json:"rate"`
+	// Inclusive taxes are already in the prices; exclusive ones are added on
+	Inclusive bool     `json:"inclusive"`
+	Rounding  Rounding `json:"rounding,omitempty"`
+	// Round the tax on each item and add them up, rather than rounding the
+	// tax on the total
+	PerLine bool `json:"per_line,omitempty"`
+	// Kinds of item the tax doesn't apply to, e.g. "fee"
+	Exempt []string `json:"exempt,omitempty"`
+}
+
+// Rules are the adjustments to ticket prices and the fees and taxes to
+// apply. Taxes apply to the fees too unless the fees are exempt.
+type Rules struct {
+	Adjustments []Adjustment `json:"adjustments,omitempty"`
+	Fees        []Fee        `json:"fees"`
+	Taxes       []Tax        `json:"taxes"`
+}
+
+// ErrInvalidRules is returned for rules that can't be applied.
+var ErrInvalidRules = errors.New("pricing: invalid rules")
+
+// Validate checks the rules can be applied.
+func (r Rules) Validate() error {
+	for _, adjustment := range r.Adjustments {
+		if err := adjustment.validate(); err != nil {
+			return err
+		}
+	}
+	for _, fee := range r.Fees {
+		if fee.Name == "" {
+			return fmt.Errorf("%w: fee without a name", ErrInvalidRules)
+		}
+		if fee.Channel != "" && fee.Channel != Web && fee.Channel != BoxOffice {
+			return fmt.Errorf("%w: fee %q has unknown channel %q", ErrInvalidRules, fee.Name, fee.Channel)
+		}
+		if fee.PerTicket.IsNegative() || fee.PerBooking.IsNegative() {
+			return fmt.Errorf("%w: fee %q is negative", ErrInvalidRules, fee.Name)
+		}
+	}
+	for _, tax := range r.Taxes {
+		if tax.Name == "" {
+			return fmt.Errorf("%w: tax without a name", ErrInvalidRules)
+		}
+		if tax.Rate < 0 || tax.Rate > 100 || math.IsNaN(tax.Rate) {
+			return fmt.Errorf("%w: tax %q rate must be between 0 and 100", ErrInvalidRules, tax.Name)
+		}
+		switch tax.Rounding {
+		case "", HalfUp, HalfEven, Down, Up:
+		default:
+			return fmt.Errorf("%w: tax %q has unknown rounding %q", ErrInvalidRules, tax.Name, tax.Rounding)
+		}
+		for _, kind := range tax.Exempt {
+			switch strings.ToLower(kind) {
+			case KindSeat, KindFee, KindDiscount, KindTax, KindAddOn:
+			default:
+				return fmt.Errorf("%w: tax %q exempts unknown kind %q", ErrInvalidRules, tax.Name, kind)
+			}
+		}
+	}
+	return nil
+}
+
+// Apply adds the fees for a channel and the taxes to a booking's seats and
+// add-ons. Earlier fee and tax items in the input are dropped, so a booking
+// can be priced again.
+func (r Rules) Apply(items []Item, channel string) []Item {
+	priced := make([]Item, 0, len(items)+len(r.Fees)+len(r.Taxes))
+	tickets := 0
+	for _, item := range items {
+		if item.Kind == KindFee || item.Kind == KindTax {
+			continue
+		}
+		if item.Kind == KindSeat {
+			tickets += item.Quantity
+		}
+		priced = append(priced, item)
+	}
+
+	for _, fee := range r.Fees {
+		if fee.Channel != "" && fee.Channel != channel {
+			continue
+		}
+		if fee.PerTicket.IsPositive() && tickets > 0 {
+			priced = append(priced, Item{
+				Kind:        KindFee,
+				Description: fee.Name,
+				Quantity:    tickets,
+				UnitAmount:  fee.PerTicket,
+				Amount:      fee.PerTicket.Mul(tickets),
+			})
+		}
+		if fee.PerBooking.IsPositive() {
+			priced = append(priced, Item{
+				Kind:        KindFee,
+				Description: fee.Name,
+				Quantity:    1,
+				UnitAmount:  fee.PerBooking,
+				Amount:      fee.PerBooking,
+			})
+		}
+	}
+
+	// Every tax is worked out on the items before tax
+	taxable := priced
+	for _, tax := range r.Taxes {
+		amount := tax.on(taxable)
+		if amount.IsZero() {
+			continue
+		}
+		priced = append(priced, Item{
+			Kind:        KindTax,
+			Description: fmt.Sprintf("%s at %g%%", tax.Name, tax.Rate),
+			Quantity:    1,
+			UnitAmount:  amount,
+			Amount:      amount,
+			Included:    tax.Inclusive,
+		})
+	}
+	return priced
+}
+
+// on works out the tax on items
+func (t Tax) on(items []Item) money.Money {
+	var base, total money.Money
+	for _, item := range items {
+		if item.Included || t.exempts(item.Kind) {
+			continue
+		}
+		if t.PerLine {
+			total = total.Add(t.of(item.Amount))
+		} else {
+			base = base.Add(item.Amount)
+		}
+	}
+	if t.PerLine {
+		return total
+	}
+	return t.of(base)
+}
+
+// of is the tax on an amount
+func (t Tax) of(amount money.Money) money.Money {
+	// Rates are applied in hundredths of a percent to keep the maths exact
+	rate := int64(math.Round(t.Rate * 100))
+	den := int64(10000)
+	if t.Inclusive {
+		den += rate
+	}
+	return money.New(divide(amount.Cents*rate, den, t.Rounding), amount.Currency)
+}
+
+func (t Tax) exempts(kind string) bool {
+	for _, exempt := range t.Exempt {
+		if strings.EqualFold(exempt, kind) {
+			return true
+		}
+	}
+	return false
+}
+
+// divide returns num/den rounded to a whole number. den must be positive.
+func divide(num, den int64, rounding Rounding) int64 {
+	quotient, remainder := num/den, num%den
+	if remainder == 0 {
+		return quotient
+	}
+	sign := int64(1)
+	if num < 0 {
+		sign, remainder = -1, -remainder
+	}
+
+	switch rounding {
+	case Down:
+		return quotient
+	case Up:
+		return quotient + sign
+	case HalfEven:
+		if 2*remainder > den || (2*remainder == den && quotient%2 != 0) {
+			return quotient + sign
+		}
+		return quotient
+	default:
+		if 2*remainder >= den {
+			return quotient + sign
+		}
+		return quotient
+	}
+}
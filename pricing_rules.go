@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"strconv"
+
+	"cinemabooking/money"
+	"cinemabooking/pricing"
+)
+
+// pricingRules are the adjustments to ticket prices and the booking fees and
+// taxes, loaded at startup
+var pricingRules pricing.Rules
+
+// initPricing loads the pricing rules from the JSON file named by
+// PRICING_RULES. Without one, VAT_RATE is charged as VAT included in prices
+// and BOOKING_FEE_WEB / BOOKING_FEE_BOX_OFFICE as fees per ticket.
+func initPricing() {
+	pricingRules = defaultPricingRules()
+	if path := os.Getenv("PRICING_RULES"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatalf("Error reading PRICING_RULES: %v", err)
+		}
+		pricingRules = pricing.Rules{}
+		if err := json.Unmarshal(data, &pricingRules); err != nil {
+			log.Fatalf("Error parsing PRICING_RULES: %v", err)
+		}
+	}
+	if err := pricingRules.Validate(); err != nil {
+		log.Fatalf("Error in pricing rules: %v", err)
+	}
+	log.Printf("Pricing with %d adjustments, %d fees and %d taxes", len(pricingRules.Adjustments), len(pricingRules.Fees), len(pricingRules.Taxes))
+}
+
+// defaultPricingRules builds the rules from environment variables
+func defaultPricingRules() pricing.Rules {
+	var rules pricing.Rules
+	fees := []struct{ channel, env string }{
+		{pricing.Web, "BOOKING_FEE_WEB"},
+		{pricing.BoxOffice, "BOOKING_FEE_BOX_OFFICE"},
+	}
+	for _, fee := range fees {
+		amount, err := money.Parse(os.Getenv(fee.env), cinemaCurrency())
+		if err == nil && amount.IsPositive() {
+			rules.Fees = append(rules.Fees, pricing.Fee{Name: "Booking fee", Channel: fee.channel, PerTicket: amount})
+		}
+	}
+	if rate := vatPercent(); rate > 0 {
+		rules.Taxes = append(rules.Taxes, pricing.Tax{Name: "VAT", Rate: rate, Inclusive: true})
+	}
+	return rules
+}
+
+// vatPercent is the VAT included in prices, from VAT_RATE as a percentage
+func vatPercent() float64 {
+	rate, err := strconv.ParseFloat(os.Getenv("VAT_RATE"), 64)
+	if err != nil || rate < 0 || rate > 100 {
+		return 0
+	}
+	return rate
+}
+
+// receiptTaxRate is the VAT rate shown on receipts. Rules from PRICING_RULES
+// may hold several taxes, so receipts only break VAT out for the default rules.
+func receiptTaxRate() float64 {
+	if os.Getenv("PRICING_RULES") != "" {
+		return 0
+	}
+	return vatPercent() / 100
+}
+
+// priceItems adds the fees of a sales channel and the taxes to the seats and
+// add-ons of a booking
+func priceItems(items []BookingItem, channel string) []BookingItem {
+	return pricingRules.Apply(items, channel)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+
+	"cinemabooking/money"
+)
+
+// BookingRefund is the result of refunding a booking at the counter
+type BookingRefund struct {
+	BookingID int         `json:"booking_id"`
+	Reference string      `json:"reference"`
+	Refund    money.Money `json:"refund"`
+	Reason    string      `json:"reason"`
+}
+
+// Cancel a booking at the counter, releasing its seats and refunding it in full
+func refundBooking(w http.ResponseWriter, r *http.Request) {
+	bookingID, ok := authorizeBooking(w, r)
+	if !ok {
+		return
+	}
+
+	var refundRequest struct {
+		Reason string `json:"reason"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&refundRequest)
+	if err != nil && err != io.EOF {
+		log.Printf("Error decoding request: %v", err)
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	if refundRequest.Reason == "" {
+		refundRequest.Reason = "Refunded at the box office"
+	}
+
+	tx, err := dbConn.Begin()
+	if err != nil {
+		log.Printf("Error beginning transaction: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	refund := BookingRefund{BookingID: bookingID, Reason: refundRequest.Reason}
+	var showID int
+	err = tx.QueryRow("SELECT reference, show_id FROM bookings WHERE id = ?", bookingID).Scan(&refund.Reference, &showID)
+	if err != nil {
+		log.Printf("Error fetching booking %d: %v", bookingID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	refund.Refund, err = cancelBookingTx(tx, bookingID, refundRequest.Reason)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Only confirmed bookings can be refunded", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error cancelling booking %d: %v", bookingID, err)
+		http.Error(w, "Error refunding booking", http.StatusInternalServerError)
+		return
+	}
+
+	// Counter sales are paid back from the refunding staff member's till
+	user, err := currentUser(r)
+	if err == nil {
+		err = recordTillRefundTx(tx, bookingID, user)
+	}
+	if err != nil {
+		log.Printf("Error recording refund of booking %d on till: %v", bookingID, err)
+		http.Error(w, "Error refunding booking", http.StatusInternalServerError)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Refunded booking %d: %s", bookingID, refund.Refund)
+
+	// The freed seats can go to anyone waiting for the show
+	if _, err := offerWaitlistSeats(showID); err != nil {
+		log.Printf("Error offering seats to the waitlist for show %d: %v", showID, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(refund)
+}
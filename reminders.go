@@ -0,0 +1,136 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"cinemabooking/notifications"
+)
+
+// How often the scheduler looks for shows needing reminders
+const reminderInterval = time.Minute
+
+// Default for REMINDER_HOURS_BEFORE
+const defaultReminderLead = 24 * time.Hour
+
+// How long a claimed reminder can go unsent before another run may claim it,
+// in case the instance that claimed it stopped before delivering it
+const reminderClaimTimeout = 15 * time.Minute
+
+// reminderLead is how long before a show its reminders go out, from
+// REMINDER_HOURS_BEFORE
+func reminderLead() time.Duration {
+	hours, err := strconv.Atoi(os.Getenv("REMINDER_HOURS_BEFORE"))
+	if err != nil || hours <= 0 {
+		return defaultReminderLead
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// Periodically send reminders for shows starting within the lead time
+func runReminderScheduler() {
+	lead := reminderLead()
+	ticker := time.NewTicker(reminderInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := sendDueReminders(time.Now().UTC(), lead); err != nil {
+			log.Printf("Error sending show reminders: %v", err)
+		}
+	}
+}
+
+// sendDueReminders emails every confirmed booking for a scheduled show that
+// starts within lead of now and hasn't been reminded yet. Reminders are
+// claimed in booking_reminders and marked sent once delivered, so a restart
+// doesn't send them again and a failed delivery is tried again.
+func sendDueReminders(now time.Time, lead time.Duration) error {
+	rows, err := dbConn.Query(`
+		SELECT b.id
+		FROM bookings b
+		JOIN shows s ON s.id = b.show_id
+		LEFT JOIN booking_reminders r ON r.booking_id = b.id
+		WHERE b.status = 'confirmed' AND s.status = 'scheduled'
+			AND s.start_time > ? AND s.start_time <= ?
+			AND COALESCE(b.user_email, '') <> ''
+			AND (r.booking_id IS NULL OR (r.sent_at IS NULL AND r.claimed_at < ?))
+	`, now, now.Add(lead), now.Add(-reminderClaimTimeout))
+	if err != nil {
+		return err
+	}
+
+	var bookingIDs []int
+	for rows.Next() {
+		var bookingID int
+		if err := rows.Scan(&bookingID); err != nil {
+			rows.Close()
+			return err
+		}
+		bookingIDs = append(bookingIDs, bookingID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, bookingID := range bookingIDs {
+		if err := sendReminder(bookingID, now); err != nil {
+			log.Printf("Error sending reminder for booking %d: %v", bookingID, err)
+		}
+	}
+	return nil
+}
+
+// sendReminder claims and sends the reminder for one booking
+func sendReminder(bookingID int, now time.Time) error {
+	// Claiming the reminder first stops two instances both sending it. A
+	// claim that was never sent can be taken over once it times out.
+	result, err := dbConn.Exec(`
+		INSERT INTO booking_reminders (booking_id, claimed_at) VALUES (?, ?)
+		ON DUPLICATE KEY UPDATE claimed_at = IF(sent_at IS NULL AND claimed_at < ?, VALUES(claimed_at), claimed_at)
+	`, bookingID, now, now.Add(-reminderClaimTimeout))
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return err
+	}
+
+	booking, err := bookingEmail(dbConn, bookingID)
+	if err != nil {
+		unclaimReminder(bookingID)
+		return err
+	}
+	msg, err := notifications.ShowReminder(booking)
+	if err != nil {
+		unclaimReminder(bookingID)
+		return err
+	}
+
+	// The reminder only counts as sent once the mail server has taken it
+	msg.Done = func(err error) {
+		if err != nil {
+			log.Printf("Reminder for booking %d was not delivered: %v", bookingID, err)
+			unclaimReminder(bookingID)
+			return
+		}
+		if _, err := dbConn.Exec("UPDATE booking_reminders SET sent_at = ? WHERE booking_id = ?", time.Now().UTC(), bookingID); err != nil {
+			log.Printf("Error recording reminder for booking %d: %v", bookingID, err)
+		}
+	}
+	if err := mailer.Send(msg); err != nil {
+		return err
+	}
+
+	log.Printf("Queued reminder for booking %d", bookingID)
+	return nil
+}
+
+// unclaimReminder lets the next run try a reminder that wasn't sent again
+func unclaimReminder(bookingID int) {
+	if _, err := dbConn.Exec("DELETE FROM booking_reminders WHERE booking_id = ? AND sent_at IS NULL", bookingID); err != nil {
+		log.Printf("Error unclaiming reminder for booking %d: %v", bookingID, err)
+	}
+}
@@ -0,0 +1,155 @@
+// Package schedule expands recurring schedule templates into concrete show
+// times and finds clashes between shows on the same screen.
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"cinemabooking/money"
+)
+
+// Longest date range a single template may cover
+const maxRangeDays = 366
+
+// Template describes a run of a movie on one screen.
+type Template struct {
+	MovieID    int         `json:"movie_id"`
+	Screen     string      `json:"screen"`
+	Days       []string    `json:"days"`        // mon, tue, ... sun
+	StartTimes []string    `json:"start_times"` // HH:MM in the cinema's time zone
+	From       string      `json:"from"`        // first day, YYYY-MM-DD
+	To         string      `json:"to"`          // last day, inclusive
+	Price      money.Money `json:"price"`
+	// Minutes needed to clean the screen between shows
+	TurnaroundMinutes int `json:"turnaround_minutes"`
+	// Whether bookings may leave single empty seats; unset means they can't
+	EnforceSeatGaps *bool `json:"enforce_seat_gaps,omitempty"`
+}
+
+// Slot is one show produced from a template.
+type Slot struct {
+	Start time.Time
+	End   time.Time
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Validate checks the template fields that don't need the database.
+func (t Template) Validate() error {
+	if t.MovieID <= 0 {
+		return errors.New("movie_id is required")
+	}
+	if strings.TrimSpace(t.Screen) == "" {
+		return errors.New("screen is required")
+	}
+	if len(t.Days) == 0 {
+		return errors.New("at least one day is required")
+	}
+	for _, day := range t.Days {
+		if _, ok := weekdays[strings.ToLower(day)]; !ok {
+			return fmt.Errorf("unknown day %q, use mon, tue, wed, thu, fri, sat or sun", day)
+		}
+	}
+	if len(t.StartTimes) == 0 {
+		return errors.New("at least one start time is required")
+	}
+	for _, start := range t.StartTimes {
+		if _, err := time.Parse("15:04", start); err != nil {
+			return fmt.Errorf("start time %q must be in HH:MM format", start)
+		}
+	}
+	if !t.Price.IsPositive() {
+		return errors.New("price must be greater than zero")
+	}
+	if t.TurnaroundMinutes < 0 {
+		return errors.New("turnaround_minutes can't be negative")
+	}
+	return nil
+}
+
+// Turnaround is the gap required between two shows on the same screen.
+func (t Template) Turnaround() time.Duration {
+	return time.Duration(t.TurnaroundMinutes) * time.Minute
+}
+
+// Expand returns every show the template produces, in start order. Start
+// times are wall-clock times in loc, so a 19:00 show stays at 19:00 when the
+// clocks change.
+func Expand(t Template, runtime time.Duration, loc *time.Location) ([]Slot, error) {
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+
+	from, err := time.ParseInLocation("2006-01-02", t.From, loc)
+	if err != nil {
+		return nil, errors.New("from must be in YYYY-MM-DD format")
+	}
+	to, err := time.ParseInLocation("2006-01-02", t.To, loc)
+	if err != nil {
+		return nil, errors.New("to must be in YYYY-MM-DD format")
+	}
+	if to.Before(from) {
+		return nil, errors.New("to must not be before from")
+	}
+	if to.Sub(from) > maxRangeDays*24*time.Hour {
+		return nil, fmt.Errorf("a schedule can cover at most %d days", maxRangeDays)
+	}
+
+	days := make(map[time.Weekday]bool)
+	for _, day := range t.Days {
+		days[weekdays[strings.ToLower(day)]] = true
+	}
+
+	var slots []Slot
+	for day := from; !day.After(to); day = time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, loc) {
+		if !days[day.Weekday()] {
+			continue
+		}
+		for _, startTime := range t.StartTimes {
+			clock, _ := time.Parse("15:04", startTime)
+			start := time.Date(day.Year(), day.Month(), day.Day(), clock.Hour(), clock.Minute(), 0, 0, loc)
+			slots = append(slots, Slot{Start: start, End: start.Add(runtime)})
+		}
+	}
+
+	sort.Slice(slots, func(i, j int) bool { return slots[i].Start.Before(slots[j].Start) })
+	return slots, nil
+}
+
+// Overlaps reports whether two shows on the same screen are too close,
+// allowing for the turnaround between them.
+func Overlaps(a, b Slot, turnaround time.Duration) bool {
+	return a.Start.Before(b.End.Add(turnaround)) && b.Start.Before(a.End.Add(turnaround))
+}
+
+// Conflicts returns, for each slot, the indexes of the earlier slots in the
+// same list and the existing slots it clashes with.
+func Conflicts(slots, existing []Slot, turnaround time.Duration) (internal map[int][]int, external map[int][]int) {
+	internal = make(map[int][]int)
+	external = make(map[int][]int)
+	for i, slot := range slots {
+		for j := 0; j < i; j++ {
+			if Overlaps(slot, slots[j], turnaround) {
+				internal[i] = append(internal[i], j)
+			}
+		}
+		for j, other := range existing {
+			if Overlaps(slot, other, turnaround) {
+				external[i] = append(external[i], j)
+			}
+		}
+	}
+	return internal, external
+}
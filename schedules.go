@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"cinemabooking/money"
+	"cinemabooking/schedule"
+)
+
+// Seat layout given to shows created by the scheduler
+var (
+	defaultSeatRows    = []string{"A", "B", "C", "D", "E"}
+	defaultSeatsPerRow = 10
+)
+
+// ScheduledShow is a show produced by a schedule template
+type ScheduledShow struct {
+	ID        int         `json:"id,omitempty"`
+	MovieID   int         `json:"movie_id"`
+	Screen    string      `json:"screen"`
+	StartTime time.Time   `json:"start_time"`
+	EndTime   time.Time   `json:"end_time"`
+	Price     money.Money `json:"price"`
+	// Bookings can't leave single empty seats
+	EnforceSeatGaps bool     `json:"enforce_seat_gaps"`
+	Conflicts       []string `json:"conflicts,omitempty"`
+}
+
+// SchedulePreview is the result of expanding (and maybe committing) a template
+type SchedulePreview struct {
+	DryRun    bool            `json:"dry_run"`
+	Shows     []ScheduledShow `json:"shows"`
+	Conflicts int             `json:"conflicts"`
+	Created   int             `json:"created"`
+}
+
+// Expand a recurring schedule into shows. With ?dry_run=true nothing is
+// written; otherwise the shows and their seats are created, unless any of them
+// clash with another show on the same screen.
+func createSchedule(w http.ResponseWriter, r *http.Request) {
+	var template schedule.Template
+	err := json.NewDecoder(r.Body).Decode(&template)
+	if err != nil {
+		log.Printf("Error decoding request: %v", err)
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+
+	var duration int
+	err = dbConn.QueryRow("SELECT duration FROM movies WHERE id = ?", template.MovieID).Scan(&duration)
+	if err != nil {
+		log.Printf("Error fetching movie %d: %v", template.MovieID, err)
+		http.Error(w, "Movie not found", http.StatusNotFound)
+		return
+	}
+
+	slots, err := schedule.Expand(template, time.Duration(duration)*time.Minute, cinemaLocation)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(slots) == 0 {
+		http.Error(w, "The schedule doesn't produce any shows", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := dbConn.Begin()
+	if err != nil {
+		log.Printf("Error beginning transaction: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// Lock the screen's shows in the range so two schedules can't both pass
+	turnaround := template.Turnaround()
+	rows, err := tx.Query(`
+		SELECT id, start_time, end_time FROM shows
+		WHERE screen = ? AND start_time < ? AND end_time > ? AND status != 'cancelled'
+		FOR UPDATE
+	`, template.Screen, slots[len(slots)-1].End.Add(turnaround).UTC(), slots[0].Start.Add(-turnaround).UTC())
+	if err != nil {
+		log.Printf("Error fetching existing shows: %v", err)
+		http.Error(w, "Failed to fetch shows", http.StatusInternalServerError)
+		return
+	}
+
+	var existingIDs []int
+	var existing []schedule.Slot
+	for rows.Next() {
+		var id int
+		var slot schedule.Slot
+		if err := rows.Scan(&id, &slot.Start, &slot.End); err != nil {
+			rows.Close()
+			log.Printf("Error scanning show: %v", err)
+			http.Error(w, "Failed to scan show", http.StatusInternalServerError)
+			return
+		}
+		existingIDs = append(existingIDs, id)
+		existing = append(existing, slot)
+	}
+	rows.Close()
+
+	internal, external := schedule.Conflicts(slots, existing, turnaround)
+
+	preview := SchedulePreview{DryRun: dryRun}
+	for i, slot := range slots {
+		show := ScheduledShow{
+			MovieID:   template.MovieID,
+			Screen:    template.Screen,
+			StartTime: inCinemaTime(slot.Start),
+			EndTime:   inCinemaTime(slot.End),
+			Price:     template.Price,
+			// Shows keep to the seating rules unless the template opts out
+			EnforceSeatGaps: template.EnforceSeatGaps == nil || *template.EnforceSeatGaps,
+		}
+		for _, j := range internal[i] {
+			show.Conflicts = append(show.Conflicts, "clashes with the "+inCinemaTime(slots[j].Start).Format(time.RFC3339)+" show in this schedule")
+		}
+		for _, j := range external[i] {
+			show.Conflicts = append(show.Conflicts, "clashes with show "+strconv.Itoa(existingIDs[j])+" at "+inCinemaTime(existing[j].Start).Format(time.RFC3339))
+		}
+		if len(show.Conflicts) > 0 {
+			preview.Conflicts++
+		}
+		preview.Shows = append(preview.Shows, show)
+	}
+
+	if dryRun || preview.Conflicts > 0 {
+		status := http.StatusOK
+		if !dryRun {
+			log.Printf("Schedule for screen %s has %d conflicting shows", template.Screen, preview.Conflicts)
+			status = http.StatusConflict
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(preview)
+		return
+	}
+
+	for i := range preview.Shows {
+		show := &preview.Shows[i]
+		result, err := tx.Exec(`
+			INSERT INTO shows (movie_id, screen, start_time, end_time, price, enforce_seat_gaps)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, show.MovieID, show.Screen, show.StartTime.UTC(), show.EndTime.UTC(), show.Price, show.EnforceSeatGaps)
+		if err != nil {
+			log.Printf("Error creating show: %v", err)
+			http.Error(w, "Error creating shows", http.StatusInternalServerError)
+			return
+		}
+		showID, err := result.LastInsertId()
+		if err != nil {
+			log.Printf("Error getting show ID: %v", err)
+			http.Error(w, "Error creating shows", http.StatusInternalServerError)
+			return
+		}
+		show.ID = int(showID)
+
+		if err := createSeatsForShow(tx, show.ID); err != nil {
+			log.Printf("Error creating seats for show %d: %v", show.ID, err)
+			http.Error(w, "Error creating seats", http.StatusInternalServerError)
+			return
+		}
+		preview.Created++
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Scheduled %d shows of movie %d on %s", preview.Created, template.MovieID, template.Screen)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(preview)
+}
+
+// createSeatsForShow adds the default seat layout to a new show
+func createSeatsForShow(e execer, showID int) error {
+	var placeholders []string
+	var args []interface{}
+	for _, row := range defaultSeatRows {
+		for seatNum := 1; seatNum <= defaultSeatsPerRow; seatNum++ {
+			placeholders = append(placeholders, "(?, ?, ?, 'available')")
+			args = append(args, showID, row, seatNum)
+		}
+	}
+
+	_, err := e.Exec("INSERT INTO seats (show_id, row_name, seat_number, status) VALUES "+strings.Join(placeholders, ", "), args...)
+	return err
+}
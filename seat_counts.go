@@ -0,0 +1,34 @@
+package main
+
+import "math"
+
+// Aggregates over a LEFT JOIN of seats aliased "seat": total, available,
+// held and booked seats. Holds that ran out count as available.
+const seatCountColumns = `
+	COUNT(seat.id),
+	COALESCE(SUM(seat.status = 'available' OR (seat.status = 'held' AND seat.held_until < NOW())), 0),
+	COALESCE(SUM(seat.status = 'held' AND seat.held_until >= NOW()), 0),
+	COALESCE(SUM(seat.status = 'booked'), 0)`
+
+// SeatCounts summarises the seat map of a show
+type SeatCounts struct {
+	TotalSeats     int     `json:"total_seats"`
+	AvailableSeats int     `json:"available_seats"`
+	HeldSeats      int     `json:"held_seats"`
+	BookedSeats    int     `json:"booked_seats"`
+	SellThrough    float64 `json:"sell_through"` // percentage of seats booked
+	SoldOut        bool    `json:"sold_out"`
+}
+
+// scanDest returns the destinations for the seatCountColumns in order
+func (c *SeatCounts) scanDest() []interface{} {
+	return []interface{}{&c.TotalSeats, &c.AvailableSeats, &c.HeldSeats, &c.BookedSeats}
+}
+
+// summarise fills in the fields derived from the counts
+func (c *SeatCounts) summarise() {
+	c.SoldOut = c.TotalSeats > 0 && c.AvailableSeats == 0
+	if c.TotalSeats > 0 {
+		c.SellThrough = math.Round(float64(c.BookedSeats)/float64(c.TotalSeats)*1000) / 10
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"cinemabooking/seating"
+
+	"github.com/gorilla/mux"
+)
+
+// Rules applied to every selection, and the ones a show can opt out of
+var (
+	seatGapRules = seating.NewEngine(seating.NoSingleGap{})
+	noSeatRules  = seating.NewEngine()
+)
+
+// seatRulesForShow picks the rule set configured for a show
+func seatRulesForShow(enforceSeatGaps bool) *seating.Engine {
+	if enforceSeatGaps {
+		return seatGapRules
+	}
+	return noSeatRules
+}
+
+// Turn the rule against leaving single empty seats on or off for a show.
+// Bookings already made are unaffected.
+func updateShowSeatRules(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	showID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid show ID", http.StatusBadRequest)
+		return
+	}
+
+	var rulesRequest struct {
+		EnforceSeatGaps *bool `json:"enforce_seat_gaps"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&rulesRequest)
+	if err != nil {
+		log.Printf("Error decoding request: %v", err)
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	if rulesRequest.EnforceSeatGaps == nil {
+		http.Error(w, "enforce_seat_gaps is required", http.StatusBadRequest)
+		return
+	}
+	enforce := *rulesRequest.EnforceSeatGaps
+
+	result, err := dbConn.Exec("UPDATE shows SET enforce_seat_gaps = ? WHERE id = ?", enforce, showID)
+	if err != nil {
+		log.Printf("Error updating seat rules of show %d: %v", showID, err)
+		http.Error(w, "Error updating seat rules", http.StatusInternalServerError)
+		return
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		var exists bool
+		if err := dbConn.QueryRow("SELECT EXISTS(SELECT 1 FROM shows WHERE id = ?)", showID).Scan(&exists); err != nil || !exists {
+			http.Error(w, "Show not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	log.Printf("Show %d seat gap rule enforced: %t", showID, enforce)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		ShowID          int  `json:"show_id"`
+		EnforceSeatGaps bool `json:"enforce_seat_gaps"`
+	}{showID, enforce})
+}
+
+// loadSeatRows reads the seat map of a show grouped by row, as the rules see
+// it. Seats held under holdToken count as free for that customer.
+func loadSeatRows(q queryer, showID int, holdToken string) ([]seating.Row, error) {
+	rows, err := q.Query(`
+		SELECT id, row_name, seat_number, status, COALESCE(hold_token, ''), category, accessible
+		FROM seats
+		WHERE show_id = ?
+		ORDER BY row_name, seat_number
+	`, showID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var seatRows []seating.Row
+	for rows.Next() {
+		var seat seating.Seat
+		var rowName, status, seatHoldToken string
+		if err := rows.Scan(&seat.ID, &rowName, &seat.Number, &status, &seatHoldToken, &seat.Category, &seat.Accessible); err != nil {
+			return nil, err
+		}
+		seat.Free = seatBookable(status, seatHoldToken, holdToken)
+
+		if len(seatRows) == 0 || seatRows[len(seatRows)-1].Name != rowName {
+			seatRows = append(seatRows, seating.Row{Name: rowName})
+		}
+		last := &seatRows[len(seatRows)-1]
+		last.Seats = append(last.Seats, seat)
+	}
+	return seatRows, rows.Err()
+}
+
+// checkSeatRules evaluates a selection against the current seat map of a show
+func checkSeatRules(q queryer, showID int, seatIDs []int, holdToken string, engine *seating.Engine) error {
+	seatRows, err := loadSeatRows(q, showID, holdToken)
+	if err != nil {
+		return err
+	}
+	return engine.Evaluate(seatRows, seatIDs)
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"cinemabooking/seating"
+
+	"github.com/gorilla/mux"
+)
+
+// Largest party the suggestion API will look for
+const maxPartySize = 10
+
+// SeatSuggestion is the best block found for a party
+type SeatSuggestion struct {
+	ShowID        int     `json:"show_id"`
+	Seats         []Seat  `json:"seats"`
+	Score         float64 `json:"score"`
+	HoldToken     string  `json:"hold_token,omitempty"`
+	HoldExpiresIn int     `json:"hold_expires_in,omitempty"` // seconds
+}
+
+// Suggest the best contiguous block of seats for a party, optionally holding it
+func suggestSeats(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	showID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid show ID", http.StatusBadRequest)
+		return
+	}
+
+	var suggestRequest struct {
+		PartySize     int      `json:"party_size"`
+		Category      string   `json:"category"`
+		Accessible    bool     `json:"accessible"`
+		PreferredRows []string `json:"preferred_rows"`
+		Hold          bool     `json:"hold"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&suggestRequest)
+	if err != nil {
+		log.Printf("Error decoding request: %v", err)
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	if suggestRequest.PartySize < 1 || suggestRequest.PartySize > maxPartySize {
+		http.Error(w, "Party size must be between 1 and "+strconv.Itoa(maxPartySize), http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("Suggesting %d seats for show ID %d", suggestRequest.PartySize, showID)
+
+	var enforceSeatGaps bool
+	var showStatus string
+	err = dbConn.QueryRow("SELECT enforce_seat_gaps, status FROM shows WHERE id = ?", showID).Scan(&enforceSeatGaps, &showStatus)
+	if err != nil {
+		log.Printf("Error fetching show: %v", err)
+		http.Error(w, "Show not found", http.StatusNotFound)
+		return
+	}
+	if showStatus == "cancelled" {
+		http.Error(w, "Show has been cancelled", http.StatusConflict)
+		return
+	}
+
+	tx, err := dbConn.Begin()
+	if err != nil {
+		log.Printf("Error beginning transaction: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	err = releaseExpiredHolds(tx, showID)
+	if err != nil {
+		log.Printf("Error releasing expired holds: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	// Lock the seat map so a hold can't race with another booking
+	if suggestRequest.Hold {
+		_, err = tx.Exec("SELECT id FROM seats WHERE show_id = ? FOR UPDATE", showID)
+		if err != nil {
+			log.Printf("Error locking seats: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	seatRows, err := loadSeatRows(tx, showID, "")
+	if err != nil {
+		log.Printf("Error loading seats: %v", err)
+		http.Error(w, "Failed to fetch seats", http.StatusInternalServerError)
+		return
+	}
+
+	prefs := seating.Preferences{
+		PartySize:     suggestRequest.PartySize,
+		Category:      suggestRequest.Category,
+		Accessible:    suggestRequest.Accessible,
+		PreferredRows: suggestRequest.PreferredRows,
+	}
+	block, ok := seating.Suggest(seatRows, prefs, seating.DefaultWeights, seatRulesForShow(enforceSeatGaps))
+	if !ok {
+		log.Printf("No block of %d seats found for show ID %d", suggestRequest.PartySize, showID)
+		http.Error(w, "No suitable seats available", http.StatusNotFound)
+		return
+	}
+
+	suggestion := SeatSuggestion{ShowID: showID, Score: block.Score}
+	var seatIDs []int
+	for _, seat := range block.Seats {
+		seatIDs = append(seatIDs, seat.ID)
+		suggestion.Seats = append(suggestion.Seats, Seat{
+			ID:         seat.ID,
+			ShowID:     showID,
+			Row:        block.Row,
+			SeatNumber: seat.Number,
+			Status:     "available",
+			Category:   seat.Category,
+			Accessible: seat.Accessible,
+		})
+	}
+
+	if suggestRequest.Hold {
+		suggestion.HoldToken, err = holdSeats(tx, seatIDs, seatHoldDuration)
+		if err != nil {
+			log.Printf("Error holding seats: %v", err)
+			http.Error(w, "Error holding seats", http.StatusInternalServerError)
+			return
+		}
+		suggestion.HoldExpiresIn = int(seatHoldDuration.Seconds())
+		for i := range suggestion.Seats {
+			suggestion.Seats[i].Status = "held"
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(suggestion)
+}
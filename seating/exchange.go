@@ -0,0 +1,33 @@
+package seating
+
+// Place is a seat's position in the auditorium
+type Place struct {
+	Row    string
+	Number int
+}
+
+// SamePlaces finds the seats at the given positions in another seat map. It
+// only succeeds when every one of them exists and is free, so an exchanged
+// booking keeps exactly the seats the customer had.
+func SamePlaces(rows []Row, places []Place) ([]Seat, bool) {
+	if len(places) == 0 {
+		return nil, false
+	}
+
+	index := make(map[Place]Seat)
+	for _, row := range rows {
+		for _, seat := range row.Seats {
+			index[Place{Row: row.Name, Number: seat.Number}] = seat
+		}
+	}
+
+	var seats []Seat
+	for _, place := range places {
+		seat, ok := index[place]
+		if !ok || !seat.Free {
+			return nil, false
+		}
+		seats = append(seats, seat)
+	}
+	return seats, true
+}
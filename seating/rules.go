@@ -0,0 +1,140 @@
+// Package seating holds the rules a seat selection has to pass before it can
+// be booked.
+package seating
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Seat is a single seat of a row as seen by the rules.
+type Seat struct {
+	ID         int
+	Number     int
+	Free       bool // true when the seat can still be sold
+	Category   string
+	Accessible bool
+}
+
+// Row is one row of a show's seat map, ordered by seat number.
+type Row struct {
+	Name  string
+	Seats []Seat
+}
+
+// Rule checks a proposed selection against the current state of a row.
+type Rule interface {
+	Name() string
+	Check(row Row, selected map[int]bool) error
+}
+
+// Violation is returned when a selection breaks a rule.
+type Violation struct {
+	Rule    string
+	Row     string
+	Seat    int
+	Message string
+}
+
+func (v *Violation) Error() string {
+	return v.Message
+}
+
+// Engine evaluates a set of rules over every row touched by a selection.
+type Engine struct {
+	rules []Rule
+}
+
+// NewEngine returns an engine applying the given rules in order.
+func NewEngine(rules ...Rule) *Engine {
+	return &Engine{rules: rules}
+}
+
+// Rules returns the names of the rules the engine applies.
+func (e *Engine) Rules() []string {
+	names := make([]string, 0, len(e.rules))
+	for _, rule := range e.rules {
+		names = append(names, rule.Name())
+	}
+	return names
+}
+
+// Evaluate checks the selection (seat IDs) against every row that contains a
+// selected seat and returns the first violation found.
+func (e *Engine) Evaluate(rows []Row, selected []int) error {
+	if e == nil || len(e.rules) == 0 {
+		return nil
+	}
+
+	selectedSet := make(map[int]bool, len(selected))
+	for _, id := range selected {
+		selectedSet[id] = true
+	}
+
+	for _, row := range rows {
+		if !rowTouched(row, selectedSet) {
+			continue
+		}
+		sorted := sortedRow(row)
+		for _, rule := range e.rules {
+			if err := rule.Check(sorted, selectedSet); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func rowTouched(row Row, selected map[int]bool) bool {
+	for _, seat := range row.Seats {
+		if selected[seat.ID] {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedRow(row Row) Row {
+	seats := make([]Seat, len(row.Seats))
+	copy(seats, row.Seats)
+	sort.Slice(seats, func(i, j int) bool { return seats[i].Number < seats[j].Number })
+	return Row{Name: row.Name, Seats: seats}
+}
+
+// NoSingleGap rejects selections that would leave a free seat with no free
+// neighbour on either side. The end of a row, or a missing seat number, counts
+// as a wall. Seats that were already isolated before the selection are ignored
+// so that customers are never blocked by an existing gap.
+type NoSingleGap struct{}
+
+// Name implements Rule.
+func (NoSingleGap) Name() string { return "no_single_gap" }
+
+// Check implements Rule.
+func (r NoSingleGap) Check(row Row, selected map[int]bool) error {
+	freeBefore := make(map[int]bool, len(row.Seats))
+	freeAfter := make(map[int]bool, len(row.Seats))
+	for _, seat := range row.Seats {
+		freeBefore[seat.Number] = seat.Free
+		freeAfter[seat.Number] = seat.Free && !selected[seat.ID]
+	}
+
+	for _, seat := range row.Seats {
+		if !freeAfter[seat.Number] {
+			continue
+		}
+		if isolated(freeAfter, seat.Number) && !isolated(freeBefore, seat.Number) {
+			return &Violation{
+				Rule:    r.Name(),
+				Row:     row.Name,
+				Seat:    seat.Number,
+				Message: fmt.Sprintf("Selection would leave seat %s%d on its own", row.Name, seat.Number),
+			}
+		}
+	}
+	return nil
+}
+
+func isolated(free map[int]bool, number int) bool {
+	return !free[number-1] && !free[number+1]
+}
@@ -0,0 +1,180 @@
+package seating
+
+import (
+	"math"
+	"sort"
+)
+
+// Preferences describe the block of seats a customer is looking for.
+type Preferences struct {
+	PartySize     int
+	Category      string   // only seats of this category; empty means any
+	Accessible    bool     // at least one seat in the block must be accessible
+	PreferredRows []string // rows to favour; empty means the default sweet spot
+}
+
+// Weights tune how much each factor contributes to a block's score.
+type Weights struct {
+	Centre float64 // closeness to the middle of the row
+	Row    float64 // closeness to the preferred rows
+	Aisle  float64 // distance from the ends of the row
+}
+
+// DefaultWeights favour a central view first, then a good row, then
+// keeping away from the aisle.
+var DefaultWeights = Weights{Centre: 3, Row: 2, Aisle: 1}
+
+// Block is a run of adjacent seats in one row.
+type Block struct {
+	Row   string
+	Seats []Seat
+	Score float64
+}
+
+// Suggest returns the highest scoring block of contiguous free seats that
+// satisfies the preferences and passes the given rules. Rows are expected in
+// order from the screen backwards. The second return value is false when no
+// block fits.
+func Suggest(rows []Row, prefs Preferences, weights Weights, rules *Engine) (Block, bool) {
+	if prefs.PartySize <= 0 {
+		return Block{}, false
+	}
+
+	preferred := make(map[string]bool, len(prefs.PreferredRows))
+	for _, name := range prefs.PreferredRows {
+		preferred[name] = true
+	}
+
+	var candidates []Block
+	for rowIndex, row := range rows {
+		sorted := sortedRow(row)
+		if len(sorted.Seats) == 0 {
+			continue
+		}
+		rowScore := rowPreference(rowIndex, len(rows), sorted.Name, preferred)
+
+		for _, run := range freeRuns(sorted, prefs.Category) {
+			for start := 0; start+prefs.PartySize <= len(run); start++ {
+				seats := run[start : start+prefs.PartySize]
+				if prefs.Accessible && !anyAccessible(seats) {
+					continue
+				}
+				if !passesRules(rules, sorted, seats) {
+					continue
+				}
+
+				score := weights.Centre*centreScore(sorted, seats) +
+					weights.Row*rowScore +
+					weights.Aisle*aisleScore(sorted, seats)
+				candidates = append(candidates, Block{
+					Row:   sorted.Name,
+					Seats: append([]Seat(nil), seats...),
+					Score: score,
+				})
+			}
+		}
+	}
+
+	if len(candidates) == 0 {
+		return Block{}, false
+	}
+
+	// Highest score first; ties go to the earlier row and lower seat number so
+	// the same seat map always produces the same suggestion
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Score != candidates[j].Score {
+			return candidates[i].Score > candidates[j].Score
+		}
+		if candidates[i].Row != candidates[j].Row {
+			return candidates[i].Row < candidates[j].Row
+		}
+		return candidates[i].Seats[0].Number < candidates[j].Seats[0].Number
+	})
+	return candidates[0], true
+}
+
+// freeRuns splits a row into runs of free seats with consecutive numbers
+func freeRuns(row Row, category string) [][]Seat {
+	var runs [][]Seat
+	var current []Seat
+	for _, seat := range row.Seats {
+		usable := seat.Free && (category == "" || seat.Category == category)
+		if usable && len(current) > 0 && seat.Number == current[len(current)-1].Number+1 {
+			current = append(current, seat)
+			continue
+		}
+		if len(current) > 0 {
+			runs = append(runs, current)
+		}
+		current = nil
+		if usable {
+			current = []Seat{seat}
+		}
+	}
+	if len(current) > 0 {
+		runs = append(runs, current)
+	}
+	return runs
+}
+
+func anyAccessible(seats []Seat) bool {
+	for _, seat := range seats {
+		if seat.Accessible {
+			return true
+		}
+	}
+	return false
+}
+
+func passesRules(rules *Engine, row Row, seats []Seat) bool {
+	ids := make([]int, len(seats))
+	for i, seat := range seats {
+		ids[i] = seat.ID
+	}
+	return rules.Evaluate([]Row{row}, ids) == nil
+}
+
+// centreScore is 1 for a block centred on the row and falls to 0 at the ends
+func centreScore(row Row, seats []Seat) float64 {
+	first := float64(row.Seats[0].Number)
+	last := float64(row.Seats[len(row.Seats)-1].Number)
+	halfWidth := (last - first) / 2
+	if halfWidth == 0 {
+		return 1
+	}
+	rowCentre := (first + last) / 2
+	blockCentre := float64(seats[0].Number+seats[len(seats)-1].Number) / 2
+	return 1 - math.Abs(blockCentre-rowCentre)/halfWidth
+}
+
+// rowPreference is 1 for a preferred row. Without explicit preferences the
+// sweet spot is two thirds of the way back from the screen.
+func rowPreference(index, rowCount int, name string, preferred map[string]bool) float64 {
+	if len(preferred) > 0 {
+		if preferred[name] {
+			return 1
+		}
+		return 0
+	}
+	if rowCount <= 1 {
+		return 1
+	}
+	ideal := math.Round(float64(rowCount-1) * 2 / 3)
+	return 1 - math.Abs(float64(index)-ideal)/float64(rowCount-1)
+}
+
+// aisleScore grows with the distance between the block and the nearest end of
+// the row, capped at a few seats
+func aisleScore(row Row, seats []Seat) float64 {
+	const enough = 3
+	fromStart := seats[0].Number - row.Seats[0].Number
+	fromEnd := row.Seats[len(row.Seats)-1].Number - seats[len(seats)-1].Number
+	distance := fromStart
+	if fromEnd < distance {
+		distance = fromEnd
+	}
+	if distance > enough {
+		distance = enough
+	}
+	return float64(distance) / enough
+}
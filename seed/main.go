@@ -23,7 +23,8 @@ func initDB() {
 	dbName := os.Getenv("DB_NAME")
 	dbHost := os.Getenv("DB_HOST")
 
-	dsn := dbUser + ":" + dbPass + "@tcp(" + dbHost + ")/" + dbName
+	// Show times are stored in UTC
+	dsn := dbUser + ":" + dbPass + "@tcp(" + dbHost + ")/" + dbName + "?parseTime=true&loc=UTC"
 	dbConn, err = sql.Open("mysql", dsn)
 	if err != nil {
 		log.Fatal(err)
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"cinemabooking/money"
+	"cinemabooking/notifications"
+
+	"github.com/gorilla/mux"
+)
+
+// CancelledBooking is a booking cancelled along with its show
+type CancelledBooking struct {
+	BookingID int         `json:"booking_id"`
+	UserName  string      `json:"user_name"`
+	UserEmail string      `json:"user_email"`
+	Refund    money.Money `json:"refund"`
+	Notified  bool        `json:"notified"`
+}
+
+// ShowCancellation summarises the effect of cancelling a show
+type ShowCancellation struct {
+	ShowID      int                `json:"show_id"`
+	Reason      string             `json:"reason"`
+	Bookings    []CancelledBooking `json:"bookings"`
+	RefundTotal money.Money        `json:"refund_total"`
+	EmailsSent  int                `json:"emails_sent"`
+	EmailErrors int                `json:"email_errors"`
+}
+
+// Cancel a show: cancel and refund its bookings, release its seats and tell
+// the customers
+func cancelShow(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	showID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid show ID", http.StatusBadRequest)
+		return
+	}
+
+	var cancelRequest struct {
+		Reason string `json:"reason"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&cancelRequest)
+	if err != nil {
+		log.Printf("Error decoding request: %v", err)
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	if cancelRequest.Reason == "" {
+		cancelRequest.Reason = "Show cancelled"
+	}
+
+	log.Printf("Cancelling show %d: %s", showID, cancelRequest.Reason)
+
+	tx, err := dbConn.Begin()
+	if err != nil {
+		log.Printf("Error beginning transaction: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var status string
+	err = tx.QueryRow("SELECT status FROM shows WHERE id = ? FOR UPDATE", showID).Scan(&status)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Show not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching show: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if status == "cancelled" {
+		http.Error(w, "Show is already cancelled", http.StatusConflict)
+		return
+	}
+
+	_, err = tx.Exec(`
+		UPDATE shows SET status = 'cancelled', cancelled_at = NOW(), cancellation_reason = ?
+		WHERE id = ?
+	`, cancelRequest.Reason, showID)
+	if err != nil {
+		log.Printf("Error cancelling show: %v", err)
+		http.Error(w, "Error cancelling show", http.StatusInternalServerError)
+		return
+	}
+
+	summary := ShowCancellation{ShowID: showID, Reason: cancelRequest.Reason, Bookings: []CancelledBooking{}}
+
+	rows, err := tx.Query(`
+		SELECT id, COALESCE(user_name, ''), COALESCE(user_email, '')
+		FROM bookings
+		WHERE show_id = ? AND status = 'confirmed'
+		FOR UPDATE
+	`, showID)
+	if err != nil {
+		log.Printf("Error fetching bookings: %v", err)
+		http.Error(w, "Error fetching bookings", http.StatusInternalServerError)
+		return
+	}
+	for rows.Next() {
+		var booking CancelledBooking
+		if err := rows.Scan(&booking.BookingID, &booking.UserName, &booking.UserEmail); err != nil {
+			rows.Close()
+			log.Printf("Error scanning booking: %v", err)
+			http.Error(w, "Error fetching bookings", http.StatusInternalServerError)
+			return
+		}
+		summary.Bookings = append(summary.Bookings, booking)
+	}
+	rows.Close()
+
+	// Email details are read before the seats are released
+	emails := make([]notifications.Booking, len(summary.Bookings))
+	for i, booking := range summary.Bookings {
+		emails[i], err = bookingEmail(tx, booking.BookingID)
+		if err != nil {
+			log.Printf("Error loading booking %d for email: %v", booking.BookingID, err)
+			http.Error(w, "Error fetching bookings", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	for i := range summary.Bookings {
+		booking := &summary.Bookings[i]
+		booking.Refund, err = cancelBookingTx(tx, booking.BookingID, cancelRequest.Reason)
+		if err != nil {
+			log.Printf("Error cancelling booking %d: %v", booking.BookingID, err)
+			http.Error(w, "Error cancelling bookings", http.StatusInternalServerError)
+			return
+		}
+		summary.RefundTotal = summary.RefundTotal.Add(booking.Refund)
+	}
+
+	// Nobody on the waitlist will get seats now
+	_, err = tx.Exec(`
+		UPDATE waitlist_entries SET status = 'cancelled'
+		WHERE show_id = ? AND status IN ('waiting', 'offered')
+	`, showID)
+	if err != nil {
+		log.Printf("Error cancelling waitlist: %v", err)
+		http.Error(w, "Error cancelling waitlist", http.StatusInternalServerError)
+		return
+	}
+
+	// Anything still held is released too
+	_, err = tx.Exec(`
+		UPDATE seats SET status = 'available', hold_token = NULL, held_until = NULL
+		WHERE show_id = ? AND status = 'held'
+	`, showID)
+	if err != nil {
+		log.Printf("Error releasing held seats: %v", err)
+		http.Error(w, "Error releasing seats", http.StatusInternalServerError)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	// Emails go out once the cancellation is committed
+	for i := range summary.Bookings {
+		booking := &summary.Bookings[i]
+		if booking.UserEmail == "" {
+			continue
+		}
+		msg, err := notifications.BookingCancellation(emails[i], cancelRequest.Reason, booking.Refund)
+		if err == nil {
+			err = mailer.Send(msg)
+		}
+		if err != nil {
+			log.Printf("Error emailing %s about cancelled booking %d: %v", booking.UserEmail, booking.BookingID, err)
+			summary.EmailErrors++
+			continue
+		}
+		booking.Notified = true
+		summary.EmailsSent++
+	}
+
+	log.Printf("Cancelled show %d: %d bookings, %s to refund", showID, len(summary.Bookings), summary.RefundTotal)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summary)
+}
+
+// cancelBookingTx cancels a confirmed booking, frees its seats and any food
+// and drink not yet collected, puts anything paid by voucher back on the
+// voucher and records the refund owed for the rest. It returns the amount to refund.
+func cancelBookingTx(tx *sql.Tx, bookingID int, reason string) (money.Money, error) {
+	none := noMoney()
+	totalAmount := noMoney()
+	err := tx.QueryRow("SELECT total_amount FROM bookings WHERE id = ? AND status = 'confirmed' FOR UPDATE", bookingID).Scan(&totalAmount)
+	if err != nil {
+		return none, err
+	}
+
+	_, err = tx.Exec("UPDATE bookings SET status = 'cancelled' WHERE id = ?", bookingID)
+	if err != nil {
+		return none, err
+	}
+
+	_, err = tx.Exec("UPDATE seats SET status = 'available', booking_id = NULL WHERE booking_id = ?", bookingID)
+	if err != nil {
+		return none, err
+	}
+
+	err = releaseConcessionsTx(tx, bookingID)
+	if err != nil {
+		return none, err
+	}
+
+	restored, err := restoreVouchersTx(tx, bookingID)
+	if err != nil {
+		return none, err
+	}
+	refund := totalAmount
+	for _, amount := range restored {
+		refund = refund.Sub(amount)
+	}
+	if !refund.IsPositive() {
+		return none, nil
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO refunds (booking_id, amount, reason, status)
+		VALUES (?, ?, ?, 'pending')
+	`, bookingID, refund, reason)
+	if err != nil {
+		return none, err
+	}
+
+	return refund, nil
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"cinemabooking/money"
+	"cinemabooking/pricing"
+
+	"github.com/gorilla/mux"
+)
+
+// How long a ticket price shown to a customer is honoured after demand has
+// raised it
+const priceOfferDuration = 10 * time.Minute
+
+// showDemand is the demand for a show with the given seat counts at a time
+func showDemand(counts SeatCounts, start, at time.Time) pricing.Demand {
+	return pricing.Demand{
+		Occupancy: pricing.Occupancy(counts.TotalSeats, counts.HeldSeats+counts.BookedSeats),
+		Start:     inCinemaTime(start),
+		At:        at,
+	}
+}
+
+// dynamicPrice is a show's ticket price now: its base price, from shows.price,
+// adjusted to demand by the pricing rules
+func dynamicPrice(base money.Money, counts SeatCounts, start time.Time) money.Money {
+	price, _ := pricingRules.ShowPrice(base, showDemand(counts, start, time.Now()))
+	return price
+}
+
+// currentShowPrice adjusts the base price of a show to its demand now
+func currentShowPrice(q queryer, showID int, base money.Money) (money.Money, error) {
+	var counts SeatCounts
+	var start time.Time
+	dest := append([]interface{}{&start}, counts.scanDest()...)
+	err := q.QueryRow(`
+		SELECT s.start_time,`+seatCountColumns+`
+		FROM shows s
+		LEFT JOIN seats seat ON seat.show_id = s.id
+		WHERE s.id = ?
+		GROUP BY s.id, s.start_time
+	`, showID).Scan(dest...)
+	if err != nil {
+		return base, err
+	}
+	return dynamicPrice(base, counts, start), nil
+}
+
+// Signs price offers, from PRICE_OFFER_KEY
+var (
+	offerKey     []byte
+	offerKeyOnce sync.Once
+)
+
+// priceOfferKey returns the key price offers are signed with, kept apart from
+// the other keys so it can be rotated or leak without affecting them. Without
+// PRICE_OFFER_KEY a random key is used; offers are short-lived, so a restart
+// only means prices shown just before it are no longer held.
+func priceOfferKey() []byte {
+	offerKeyOnce.Do(func() {
+		offerKey = []byte(os.Getenv("PRICE_OFFER_KEY"))
+		if len(offerKey) == 0 {
+			offerKey = make([]byte, 32)
+			if _, err := rand.Read(offerKey); err != nil {
+				log.Fatalf("Error generating price offer key: %v", err)
+			}
+		}
+	})
+	return offerKey
+}
+
+// offerPrice signs the price of a show for the customer it's shown to
+func offerPrice(showID int, price money.Money) (string, error) {
+	offer := pricing.Offer{ShowID: showID, Price: price, Expires: time.Now().Add(priceOfferDuration)}
+	return pricing.SignOffer(offer, priceOfferKey())
+}
+
+// honourPriceOffer returns the price offered to a customer for a show if it
+// is still valid and lower than the current price, or else the current price
+func honourPriceOffer(showID int, token string, current money.Money) money.Money {
+	if token == "" {
+		return current
+	}
+	offer, err := pricing.VerifyOffer(token, priceOfferKey(), time.Now())
+	if err != nil || offer.ShowID != showID || offer.Price.Currency != current.Currency {
+		return current
+	}
+	if offer.Price.Cents < current.Cents {
+		return offer.Price
+	}
+	return current
+}
+
+// Change the ticket price of a show. Existing bookings keep what they paid.
+func updateShowPrice(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	showID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid show ID", http.StatusBadRequest)
+		return
+	}
+
+	var priceRequest struct {
+		Price money.Money `json:"price"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&priceRequest)
+	if err != nil {
+		log.Printf("Error decoding request: %v", err)
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	if priceRequest.Price.IsNegative() {
+		http.Error(w, "Price must not be negative", http.StatusBadRequest)
+		return
+	}
+	price := priceRequest.Price
+
+	result, err := dbConn.Exec("UPDATE shows SET price = ? WHERE id = ?", price, showID)
+	if err != nil {
+		log.Printf("Error updating price of show %d: %v", showID, err)
+		http.Error(w, "Error updating price", http.StatusInternalServerError)
+		return
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		var exists bool
+		if err := dbConn.QueryRow("SELECT EXISTS(SELECT 1 FROM shows WHERE id = ?)", showID).Scan(&exists); err != nil || !exists {
+			http.Error(w, "Show not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	log.Printf("Show %d now costs %s", showID, price)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		ShowID int         `json:"show_id"`
+		Price  money.Money `json:"price"`
+	}{showID, price})
+}
+
+// PriceSimulation previews what the pricing rules would charge for a show
+type PriceSimulation struct {
+	ShowID    int              `json:"show_id"`
+	StartTime time.Time        `json:"start_time"`
+	BasePrice money.Money      `json:"base_price"`
+	Scenarios []SimulatedPrice `json:"scenarios"`
+}
+
+// SimulatedPrice is the price of a show under one scenario
+type SimulatedPrice struct {
+	Occupancy   float64     `json:"occupancy"`
+	At          time.Time   `json:"at"`
+	HoursBefore float64     `json:"hours_before"`
+	Price       money.Money `json:"price"`
+	Applied     []string    `json:"applied"`
+}
+
+// priceScenario is a demand to simulate; unset fields are as the show is now
+type priceScenario struct {
+	Occupancy *float64   `json:"occupancy"`
+	At        *time.Time `json:"at"`
+}
+
+// Preview a show's ticket price under the pricing rules, or under rules being
+// tried out. Each scenario sets the occupancy and when the price is asked
+// for; what it leaves out is taken from the show as it is now.
+func simulateShowPrice(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	showID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid show ID", http.StatusBadRequest)
+		return
+	}
+
+	var simulationRequest struct {
+		Adjustments *[]pricing.Adjustment `json:"adjustments"`
+		Scenarios   []priceScenario       `json:"scenarios"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&simulationRequest)
+	if err != nil && err != io.EOF {
+		log.Printf("Error decoding request: %v", err)
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	rules := pricingRules
+	if simulationRequest.Adjustments != nil {
+		rules.Adjustments = *simulationRequest.Adjustments
+		if err := rules.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	simulation := PriceSimulation{ShowID: showID, BasePrice: noMoney()}
+	var counts SeatCounts
+	dest := append([]interface{}{&simulation.StartTime, &simulation.BasePrice}, counts.scanDest()...)
+	err = dbConn.QueryRow(`
+		SELECT s.start_time, s.price,`+seatCountColumns+`
+		FROM shows s
+		LEFT JOIN seats seat ON seat.show_id = s.id
+		WHERE s.id = ?
+		GROUP BY s.id, s.start_time, s.price
+	`, showID).Scan(dest...)
+	if err != nil {
+		log.Printf("Error fetching show %d: %v", showID, err)
+		http.Error(w, "Show not found", http.StatusNotFound)
+		return
+	}
+	simulation.StartTime = inCinemaTime(simulation.StartTime)
+
+	now := showDemand(counts, simulation.StartTime, time.Now())
+	if len(simulationRequest.Scenarios) == 0 {
+		simulationRequest.Scenarios = []priceScenario{{}}
+	}
+	for _, scenario := range simulationRequest.Scenarios {
+		demand := now
+		if scenario.Occupancy != nil {
+			if *scenario.Occupancy < 0 || *scenario.Occupancy > 100 {
+				http.Error(w, "Occupancy must be between 0 and 100", http.StatusBadRequest)
+				return
+			}
+			demand.Occupancy = *scenario.Occupancy
+		}
+		if scenario.At != nil {
+			demand.At = *scenario.At
+		}
+
+		price, applied := rules.ShowPrice(simulation.BasePrice, demand)
+		simulated := SimulatedPrice{
+			Occupancy:   demand.Occupancy,
+			At:          inCinemaTime(demand.At),
+			HoursBefore: demand.HoursBefore(),
+			Price:       price,
+			Applied:     []string{},
+		}
+		for _, adjustment := range applied {
+			simulated.Applied = append(simulated.Applied, adjustment.Name)
+		}
+		simulation.Scenarios = append(simulation.Scenarios, simulated)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(simulation)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"cinemabooking/cinematime"
+	"cinemabooking/money"
+)
+
+// ShowtimeListing is every show on one cinema day
+type ShowtimeListing struct {
+	Date     string           `json:"date"`
+	TimeZone string           `json:"time_zone"`
+	Movies   []MovieShowtimes `json:"movies"`
+}
+
+// MovieShowtimes groups a day's shows of one movie by screen
+type MovieShowtimes struct {
+	MovieID   int               `json:"movie_id"`
+	Title     string            `json:"title"`
+	Duration  int               `json:"duration"`
+	Rating    string            `json:"rating"`
+	PosterURL string            `json:"poster_url"`
+	Screens   []ScreenShowtimes `json:"screens"`
+}
+
+// ScreenShowtimes is the shows of a movie on one screen
+type ScreenShowtimes struct {
+	Screen string     `json:"screen"`
+	Shows  []Showtime `json:"shows"`
+}
+
+// Showtime is a single show with its remaining seats
+type Showtime struct {
+	ID        int         `json:"id"`
+	StartTime time.Time   `json:"start_time"`
+	EndTime   time.Time   `json:"end_time"`
+	Price     money.Money `json:"price"`
+	SeatCounts
+}
+
+// List all shows on a day, grouped by movie and screen
+func getShowtimes(w http.ResponseWriter, r *http.Request) {
+	date := r.URL.Query().Get("date")
+	if date == "" {
+		date = time.Now().In(cinemaLocation).Format(cinematime.DateLayout)
+	}
+
+	dayStart, dayEnd, err := cinematime.DayBounds(date, cinemaLocation)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("Getting showtimes for %s", date)
+
+	rows, err := dbConn.Query(`
+		SELECT s.id, s.movie_id, m.title, m.duration, COALESCE(m.rating, ''), COALESCE(m.poster_url, ''),
+			s.screen, s.start_time, s.end_time, s.price,`+seatCountColumns+`
+		FROM shows s
+		JOIN movies m ON s.movie_id = m.id
+		LEFT JOIN seats seat ON seat.show_id = s.id
+		WHERE s.start_time >= ? AND s.start_time < ? AND s.status != 'cancelled'
+		GROUP BY s.id, s.movie_id, m.title, m.duration, m.rating, m.poster_url, s.screen, s.start_time, s.end_time, s.price
+		ORDER BY m.title, s.movie_id, s.screen, s.start_time
+	`, dayStart, dayEnd)
+	if err != nil {
+		log.Printf("Error fetching showtimes: %v", err)
+		http.Error(w, "Failed to fetch showtimes", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	listing := ShowtimeListing{Date: date, TimeZone: cinemaLocation.String(), Movies: []MovieShowtimes{}}
+	for rows.Next() {
+		var movie MovieShowtimes
+		var screen string
+		var show Showtime
+		dest := append([]interface{}{&show.ID, &movie.MovieID, &movie.Title, &movie.Duration, &movie.Rating, &movie.PosterURL,
+			&screen, &show.StartTime, &show.EndTime, &show.Price}, show.SeatCounts.scanDest()...)
+		err := rows.Scan(dest...)
+		if err != nil {
+			log.Printf("Error scanning showtime: %v", err)
+			http.Error(w, "Failed to scan showtime", http.StatusInternalServerError)
+			return
+		}
+		show.SeatCounts.summarise()
+		show.Price = dynamicPrice(show.Price, show.SeatCounts, show.StartTime)
+		show.StartTime = inCinemaTime(show.StartTime)
+		show.EndTime = inCinemaTime(show.EndTime)
+
+		// Rows arrive ordered by movie then screen, so groups only ever
+		// need to be appended to at the end
+		if n := len(listing.Movies); n == 0 || listing.Movies[n-1].MovieID != movie.MovieID {
+			listing.Movies = append(listing.Movies, movie)
+		}
+		current := &listing.Movies[len(listing.Movies)-1]
+		if n := len(current.Screens); n == 0 || current.Screens[n-1].Screen != screen {
+			current.Screens = append(current.Screens, ScreenShowtimes{Screen: screen})
+		}
+		group := &current.Screens[len(current.Screens)-1]
+		group.Shows = append(group.Shows, show)
+	}
+
+	if err = rows.Err(); err != nil {
+		log.Printf("Error after scanning showtimes: %v", err)
+		http.Error(w, "Error after scanning showtimes", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(listing)
+}
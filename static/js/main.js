@@ -152,7 +152,9 @@ async function createBooking() {
         const booking = await response.json();
         showSuccess('Booking successful!');
         // Redirect to booking confirmation page
-        window.location.href = `/booking/${booking.id}`;
+        // Guests open their booking with the access token issued with it
+        const query = booking.access_token ? `?token=${encodeURIComponent(booking.access_token)}` : '';
+        window.location.href = `/booking/${booking.reference}${query}`;
     } catch (error) {
         console.error('Error creating booking:', error);
         showError('Failed to create booking. Please try again.');
@@ -0,0 +1,4 @@
+// Amounts come as decimal numbers with the booking's currency code
+function formatMoney(amount, currency) {
+    return new Intl.NumberFormat(undefined, { style: 'currency', currency: currency || 'USD' }).format(amount);
+}
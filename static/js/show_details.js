@@ -12,7 +12,9 @@ document.addEventListener('DOMContentLoaded', function() {
 });
 
 let selectedSeats = [];
-let showPrice = 0;
+let quoteRequest = 0;
+// Signed price shown with the seat map, honoured at checkout for a while
+let priceOffer = null;
 
 async function loadShowDetails(showId) {
     try {
@@ -22,7 +24,6 @@ async function loadShowDetails(showId) {
         }
 
         const show = await response.json();
-        showPrice = show.price;
 
         // Load movie details
         const movieResponse = await fetch(`/api/movies/${show.movie_id}`);
@@ -78,6 +79,7 @@ async function loadSeats(showId) {
             throw new Error('Failed to load seats');
         }
 
+        priceOffer = response.headers.get('X-Price-Offer');
         const seats = await response.json();
         displaySeats(seats);
     } catch (error) {
@@ -149,6 +151,7 @@ function updateBookingSummary() {
     if (selectedSeats.length === 0) {
         selectedSeatsDiv.innerHTML = '<p>No seats selected</p>';
         totalSpan.textContent = '0';
+        quoteRequest++;
         return;
     }
 
@@ -157,7 +160,38 @@ function updateBookingSummary() {
     ).join(', ');
 
     selectedSeatsDiv.innerHTML = `<p>${seatsList}</p>`;
-    totalSpan.textContent = (selectedSeats.length * showPrice).toFixed(2);
+    updateTotal(totalSpan);
+}
+
+// The total comes from the server so fees and taxes match what is charged
+async function updateTotal(totalSpan) {
+    const requestId = ++quoteRequest;
+    const showId = new URLSearchParams(window.location.search).get('id');
+    try {
+        const response = await fetch(`/api/shows/${showId}/quote`, {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify({
+                seat_ids: selectedSeats.map(seat => seat.id),
+                price_offer: priceOffer
+            })
+        });
+        if (!response.ok) {
+            throw new Error('Failed to fetch quote');
+        }
+
+        const quote = await response.json();
+        if (requestId === quoteRequest) {
+            totalSpan.textContent = formatMoney(quote.total_amount, quote.currency);
+        }
+    } catch (error) {
+        console.error('Error:', error);
+        if (requestId === quoteRequest) {
+            totalSpan.textContent = '-';
+        }
+    }
 }
 
 async function createBooking() {
@@ -184,7 +218,9 @@ async function createBooking() {
 
         const booking = await response.json();
         alert('Booking successful!');
-        window.location.href = `/bookings/${booking.id}`;
+        // Guests open their booking with the access token issued with it
+        const query = booking.access_token ? `?token=${encodeURIComponent(booking.access_token)}` : '';
+        window.location.href = `/booking/${booking.reference}${query}`;
     } catch (error) {
         console.error('Error:', error);
         alert('Failed to create booking');
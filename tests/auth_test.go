@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"testing"
+
+	"cinemabooking/auth"
+)
+
+// TestPasswords tests hashing and checking passwords
+func TestPasswords(t *testing.T) {
+	if _, err := auth.HashPassword("short"); err != auth.ErrWeakPassword {
+		t.Errorf("Expected ErrWeakPassword for a short password, got %v", err)
+	}
+
+	hash, err := auth.HashPassword("correct horse battery")
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+	if hash == "correct horse battery" {
+		t.Error("Expected the password to be hashed")
+	}
+	if !auth.CheckPassword(hash, "correct horse battery") {
+		t.Error("Expected the password to match its hash")
+	}
+	if auth.CheckPassword(hash, "wrong horse battery") {
+		t.Error("Expected a different password not to match")
+	}
+}
+
+// TestSessionTokens tests that session tokens are random and stored hashed
+func TestSessionTokens(t *testing.T) {
+	a, err := auth.NewSessionToken()
+	if err != nil {
+		t.Fatalf("Failed to create session token: %v", err)
+	}
+	b, _ := auth.NewSessionToken()
+	if a == b {
+		t.Error("Expected distinct session tokens")
+	}
+	if auth.HashSessionToken(a) != auth.HashSessionToken(a) || auth.HashSessionToken(a) == a {
+		t.Error("Expected a stable hash different from the token")
+	}
+}
+
+// TestBookingTokens tests guest access tokens
+func TestBookingTokens(t *testing.T) {
+	key := []byte("access-key")
+	token := auth.BookingToken(key, "7GQ4M2KD")
+
+	if !auth.CheckBookingToken(key, "7GQ4M2KD", token) {
+		t.Error("Expected the token to open its booking")
+	}
+	if auth.CheckBookingToken(key, "7GQ4M2KE", token) {
+		t.Error("Expected the token not to open another booking")
+	}
+	if auth.CheckBookingToken([]byte("other-key"), "7GQ4M2KD", token) {
+		t.Error("Expected a token signed with another key to be rejected")
+	}
+	if auth.CheckBookingToken(key, "7GQ4M2KD", "") || auth.CheckBookingToken(nil, "7GQ4M2KD", token) {
+		t.Error("Expected empty tokens and keys to be rejected")
+	}
+}
+
+// TestRolePermissions tests that each role inherits the permissions below it
+func TestRolePermissions(t *testing.T) {
+	cases := []struct {
+		role auth.Role
+		perm auth.Permission
+		want bool
+	}{
+		{auth.RoleCustomer, auth.PermSellTickets, false},
+		{auth.RoleBoxOffice, auth.PermSellTickets, true},
+		{auth.RoleBoxOffice, auth.PermRefund, true},
+		{auth.RoleBoxOffice, auth.PermManagePrices, false},
+		{auth.RoleManager, auth.PermRefund, true},
+		{auth.RoleManager, auth.PermManageSchedules, true},
+		{auth.RoleManager, auth.PermManageVouchers, true},
+		{auth.RoleBoxOffice, auth.PermManageVouchers, false},
+		{auth.RoleManager, auth.PermManageConcessions, true},
+		{auth.RoleManager, auth.PermManageUsers, false},
+		{auth.RoleAdmin, auth.PermManageUsers, true},
+		{auth.RoleAdmin, auth.PermCheckIn, true},
+		{auth.Role(""), auth.PermViewBookings, false},
+		{auth.Role("superuser"), auth.PermViewBookings, false},
+	}
+	for _, c := range cases {
+		if got := c.role.Can(c.perm); got != c.want {
+			t.Errorf("%q can %s: expected %v, got %v", c.role, c.perm, c.want, got)
+		}
+	}
+
+	if auth.RoleCustomer.IsStaff() || !auth.RoleBoxOffice.IsStaff() || auth.Role("").IsStaff() {
+		t.Error("Expected only box office and above to be staff")
+	}
+
+	if role, err := auth.ParseRole("manager"); err != nil || role != auth.RoleManager {
+		t.Errorf("Expected manager to parse, got %q, %v", role, err)
+	}
+	if _, err := auth.ParseRole("root"); err != auth.ErrUnknownRole {
+		t.Errorf("Expected ErrUnknownRole, got %v", err)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/gorilla/mux"
 	"cinemabooking/db"
 	"cinemabooking/models"
+	"cinemabooking/money"
 	"cinemabooking/handlers"
 	"time"
 	"strconv"
@@ -48,7 +49,7 @@ func TestCreateBooking(t *testing.T) {
 		Screen:    "Screen 1",
 		StartTime: time.Now().Add(24 * time.Hour),
 		EndTime:   time.Now().Add(26 * time.Hour),
-		Price:     10.00,
+		Price:     money.New(1000, "USD"),
 	}
 
 	result, err = testDB.Exec(`
@@ -0,0 +1,64 @@
+package tests
+
+import (
+	"testing"
+
+	"cinemabooking/bookingref"
+)
+
+// TestBookingReferences tests generating and parsing booking references
+func TestBookingReferences(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		ref, err := bookingref.New()
+		if err != nil {
+			t.Fatalf("Failed to generate reference: %v", err)
+		}
+		if len(ref) != bookingref.Length {
+			t.Fatalf("Expected %d characters, got %q", bookingref.Length, ref)
+		}
+		if parsed, err := bookingref.Parse(ref); err != nil || parsed != ref {
+			t.Errorf("Expected %q to parse, got %q, %v", ref, parsed, err)
+		}
+		seen[ref] = true
+	}
+	if len(seen) < 100 {
+		t.Errorf("Expected 100 distinct references, got %d", len(seen))
+	}
+}
+
+// TestParseBookingReference tests normalising and checking typed references
+func TestParseBookingReference(t *testing.T) {
+	ref, _ := bookingref.New()
+
+	// Typed in lower case with a dash
+	typed := ref[:4] + "-" + ref[4:]
+	if parsed, err := bookingref.Parse(typed); err != nil || parsed != ref {
+		t.Errorf("Expected %q to parse as %q, got %q, %v", typed, ref, parsed, err)
+	}
+
+	// Every single mistyped symbol is caught
+	const alphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+	for i := 0; i < len(ref); i++ {
+		for j := 0; j < len(alphabet); j++ {
+			if alphabet[j] == ref[i] {
+				continue
+			}
+			typo := ref[:i] + string(alphabet[j]) + ref[i+1:]
+			if _, err := bookingref.Parse(typo); err != bookingref.ErrInvalid {
+				t.Fatalf("Expected typo %q of %q to be rejected", typo, ref)
+			}
+		}
+	}
+
+	for _, bad := range []string{"", "ABC", "ABCDEFGHJ", "ABCDEFU1"} {
+		if _, err := bookingref.Parse(bad); err != bookingref.ErrInvalid {
+			t.Errorf("Expected %q to be invalid, got %v", bad, err)
+		}
+	}
+
+	// Confusable letters read as digits
+	if parsed, err := bookingref.Parse("oooo-0000"); err != nil || parsed != "00000000" {
+		t.Errorf("Expected O to read as 0, got %q", parsed)
+	}
+}
@@ -0,0 +1,54 @@
+package tests
+
+import (
+	"testing"
+
+	"cinemabooking/boxoffice"
+)
+
+// TestTillReconciliation tests the end-of-shift cash count
+func TestTillReconciliation(t *testing.T) {
+	totals := boxoffice.NewTotals("USD")
+	totals.AddSale(boxoffice.Cash, usd(2598))
+	totals.AddSale(boxoffice.Cash, usd(1299))
+	totals.AddSale(boxoffice.Card, usd(2998))
+	totals.AddSale(boxoffice.Voucher, usd(1499))
+	totals.AddRefund(boxoffice.Cash, usd(1299))
+	// 20.00 sale paid 5.00 in cash and the rest by voucher
+	totals.AddSale(boxoffice.Cash, usd(500))
+	totals.AddPart(boxoffice.Voucher, usd(1500))
+
+	if totals.Count != 5 {
+		t.Errorf("Expected 5 sales, got %d", totals.Count)
+	}
+	if totals.Sales[boxoffice.Cash] != usd(4397) {
+		t.Errorf("Expected cash sales of 43.97, got %s", totals.Sales[boxoffice.Cash])
+	}
+	if totals.Sales[boxoffice.Voucher] != usd(2999) {
+		t.Errorf("Expected voucher sales of 29.99, got %s", totals.Sales[boxoffice.Voucher])
+	}
+	if totals.Net() != usd(9095) {
+		t.Errorf("Expected net takings of 90.95, got %s", totals.Net())
+	}
+
+	// Float 100 + cash 43.97 - refund 12.99 = 130.98 expected in the drawer
+	report := boxoffice.Reconcile(usd(10000), totals, usd(13000))
+	if report.ExpectedCash != usd(13098) {
+		t.Errorf("Expected 130.98 in the till, got %s", report.ExpectedCash)
+	}
+	if report.Variance != usd(-98) {
+		t.Errorf("Expected the till to be 0.98 short, got %s", report.Variance)
+	}
+}
+
+// TestParsePaymentMethod tests the accepted counter payment methods
+func TestParsePaymentMethod(t *testing.T) {
+	for _, name := range []string{"cash", "card", "voucher"} {
+		if _, err := boxoffice.ParsePaymentMethod(name); err != nil {
+			t.Errorf("Expected %q to be accepted, got %v", name, err)
+		}
+	}
+	if _, err := boxoffice.ParsePaymentMethod("cheque"); err != boxoffice.ErrUnknownPaymentMethod {
+		t.Errorf("Expected ErrUnknownPaymentMethod, got %v", err)
+	}
+}
@@ -0,0 +1,42 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"cinemabooking/cinematime"
+)
+
+// TestDayBounds tests that a cinema day covers the right instants around DST
+func TestDayBounds(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Skipf("Time zone data not available: %v", err)
+	}
+
+	tests := []struct {
+		date   string
+		length time.Duration
+	}{
+		{"2024-03-20", 24 * time.Hour},
+		{"2024-03-31", 23 * time.Hour}, // clocks go forward
+		{"2024-10-27", 25 * time.Hour}, // clocks go back
+	}
+
+	for _, tt := range tests {
+		start, end, err := cinematime.DayBounds(tt.date, london)
+		if err != nil {
+			t.Fatalf("DayBounds(%s) failed: %v", tt.date, err)
+		}
+		if got := end.Sub(start); got != tt.length {
+			t.Errorf("Expected %s to last %v, got %v", tt.date, tt.length, got)
+		}
+		if start.In(london).Hour() != 0 || end.In(london).Hour() != 0 {
+			t.Errorf("Expected %s bounds at local midnight, got %v - %v", tt.date, start, end)
+		}
+	}
+
+	if _, _, err := cinematime.DayBounds("20/03/2024", london); err != cinematime.ErrInvalidDate {
+		t.Errorf("Expected ErrInvalidDate, got %v", err)
+	}
+}
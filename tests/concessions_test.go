@@ -0,0 +1,51 @@
+package tests
+
+import (
+	"testing"
+
+	"cinemabooking/concessions"
+)
+
+// TestNormalizeConcessions tests merging and checking concession orders
+func TestNormalizeConcessions(t *testing.T) {
+	lines, err := concessions.Normalize([]concessions.Line{
+		{ItemID: 3, Quantity: 1},
+		{ItemID: 1, Quantity: 2},
+		{ItemID: 3, Quantity: 2},
+	})
+	if err != nil {
+		t.Fatalf("Error normalizing order: %v", err)
+	}
+	if len(lines) != 2 || lines[0] != (concessions.Line{ItemID: 1, Quantity: 2}) || lines[1] != (concessions.Line{ItemID: 3, Quantity: 3}) {
+		t.Errorf("Expected items 1 x2 and 3 x3, got %v", lines)
+	}
+
+	if _, err := concessions.Normalize([]concessions.Line{{ItemID: 1, Quantity: 0}}); err != concessions.ErrInvalidQuantity {
+		t.Errorf("Expected ErrInvalidQuantity for no items, got %v", err)
+	}
+	if _, err := concessions.Normalize([]concessions.Line{{ItemID: 1, Quantity: 15}, {ItemID: 1, Quantity: 6}}); err != concessions.ErrInvalidQuantity {
+		t.Errorf("Expected ErrInvalidQuantity above the limit, got %v", err)
+	}
+	if _, err := concessions.Normalize([]concessions.Line{{ItemID: 0, Quantity: 1}}); err != concessions.ErrInvalidItem {
+		t.Errorf("Expected ErrInvalidItem, got %v", err)
+	}
+}
+
+// TestPickupCodes tests generating and reading back pickup codes
+func TestPickupCodes(t *testing.T) {
+	code, err := concessions.NewPickupCode()
+	if err != nil {
+		t.Fatalf("Error generating pickup code: %v", err)
+	}
+	if len(code) != concessions.PickupCodeLength {
+		t.Fatalf("Expected a %d character code, got %q", concessions.PickupCodeLength, code)
+	}
+
+	parsed, err := concessions.ParsePickupCode(" " + code[:3] + "-" + code[3:] + " ")
+	if err != nil || parsed != code {
+		t.Errorf("Expected %q to parse back, got %q (%v)", code, parsed, err)
+	}
+	if _, err := concessions.ParsePickupCode("AB0CDE"); err != concessions.ErrInvalidPickupCode {
+		t.Errorf("Expected ErrInvalidPickupCode for a 0, got %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+package tests
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"cinemabooking/documents"
+	"cinemabooking/money"
+)
+
+func eur(cents int64) money.Money {
+	return money.New(cents, "EUR")
+}
+
+func sampleDocumentBooking() documents.Booking {
+	return documents.Booking{
+		Reference:  "7GQ4M2KD",
+		Customer:   "Zoë Adams",
+		Email:      "zoe@example.com",
+		MovieTitle: "Amélie",
+		Screen:     "Screen 2",
+		StartTime:  time.Date(2024, 3, 20, 19, 30, 0, 0, time.UTC),
+		BookedAt:   time.Date(2024, 3, 18, 10, 0, 0, 0, time.UTC),
+		Seats:      []string{"C4", "C5"},
+		Currency:   "EUR",
+		Items:      []documents.LineItem{{Description: "Admission: Amélie", Quantity: 2, UnitPrice: eur(1200)}},
+		TaxRate:    0.2,
+	}
+}
+
+// TestReceiptTotals tests the tax included in receipt totals
+func TestReceiptTotals(t *testing.T) {
+	booking := sampleDocumentBooking()
+	if booking.Total() != eur(2400) || booking.Tax() != eur(400) || booking.Net() != eur(2000) {
+		t.Errorf("Expected total 24 = 20 net + 4 VAT, got %s = %s + %s", booking.Total(), booking.Net(), booking.Tax())
+	}
+
+	booking.TaxRate = 0
+	if booking.Tax() != eur(0) || booking.Net() != eur(2400) {
+		t.Errorf("Expected no tax without a rate, got %s", booking.Tax())
+	}
+}
+
+// TestReceiptTaxLines tests totals with tax worked out by the pricing rules
+func TestReceiptTaxLines(t *testing.T) {
+	booking := sampleDocumentBooking()
+	booking.Taxes = []documents.TaxLine{
+		{Description: "VAT at 20%", Amount: eur(400), Included: true},
+		{Description: "City tax at 5%", Amount: eur(120)},
+	}
+	if booking.Total() != eur(2520) || booking.Tax() != eur(520) || booking.Net() != eur(2000) {
+		t.Errorf("Expected total 25.20 = 20 net + 5.20 tax, got %s = %s + %s", booking.Total(), booking.Net(), booking.Tax())
+	}
+
+	receipt, err := documents.Receipt(booking)
+	if err != nil || !bytes.HasPrefix(receipt, []byte("%PDF-")) {
+		t.Errorf("Failed to render receipt with tax lines: %v", err)
+	}
+}
+
+// TestRenderDocuments tests that tickets and receipts render as PDFs
+func TestRenderDocuments(t *testing.T) {
+	booking := sampleDocumentBooking()
+
+	ticket, err := documents.Ticket(booking)
+	if err != nil {
+		t.Fatalf("Failed to render ticket: %v", err)
+	}
+	if !bytes.HasPrefix(ticket, []byte("%PDF-")) {
+		t.Errorf("Expected a PDF ticket")
+	}
+
+	receipt, err := documents.Receipt(booking)
+	if err != nil {
+		t.Fatalf("Failed to render receipt: %v", err)
+	}
+	if !bytes.HasPrefix(receipt, []byte("%PDF-")) {
+		t.Errorf("Expected a PDF receipt")
+	}
+}
@@ -0,0 +1,160 @@
+package tests
+
+import (
+	"encoding/json"
+	"testing"
+
+	"cinemabooking/money"
+)
+
+func usd(cents int64) money.Money {
+	return money.New(cents, "USD")
+}
+
+// TestMoneyParse tests reading decimal amounts exactly
+func TestMoneyParse(t *testing.T) {
+	tests := []struct {
+		in    string
+		cents int64
+		ok    bool
+	}{
+		{"12.99", 1299, true},
+		{"0.1", 10, true},
+		{"7", 700, true},
+		{".5", 50, true},
+		{"-3.05", -305, true},
+		{"1.999", 0, false},
+		{"", 0, false},
+		{"abc", 0, false},
+		{"1.2.3", 0, false},
+	}
+
+	for _, test := range tests {
+		m, err := money.Parse(test.in, "GBP")
+		if (err == nil) != test.ok {
+			t.Errorf("Parse(%q) error = %v; expected ok = %v", test.in, err, test.ok)
+			continue
+		}
+		if test.ok && (m.Cents != test.cents || m.Currency != "GBP") {
+			t.Errorf("Parse(%q) = %d %s; expected %d GBP", test.in, m.Cents, m.Currency, test.cents)
+		}
+	}
+}
+
+// TestMoneyArithmetic tests that sums of prices don't drift like floats do
+func TestMoneyArithmetic(t *testing.T) {
+	price := money.New(10, "USD")
+	total := money.New(0, "USD")
+	for i := 0; i < 10; i++ {
+		total = total.Add(price)
+	}
+	if total.String() != "1.00" {
+		t.Errorf("Ten lots of 0.10 = %s; expected 1.00", total)
+	}
+
+	if got := money.New(1299, "USD").Mul(3).Sub(money.New(500, "USD")); got.Cents != 3397 {
+		t.Errorf("3 x 12.99 - 5.00 = %s; expected 33.97", got)
+	}
+	if got := money.New(-305, "USD").String(); got != "-3.05" {
+		t.Errorf("String() = %s; expected -3.05", got)
+	}
+
+	// The zero value takes on the currency of what it is added to
+	if got := (money.Money{}).Add(price); got.Currency != "USD" {
+		t.Errorf("Zero value plus USD has currency %q; expected USD", got.Currency)
+	}
+}
+
+// TestMoneyCurrencyMismatch tests that different currencies can't be added
+func TestMoneyCurrencyMismatch(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Adding GBP to USD should panic")
+		}
+	}()
+	money.New(100, "USD").Add(money.New(100, "GBP"))
+}
+
+// TestMoneySplit tests splitting an amount without losing cents
+func TestMoneySplit(t *testing.T) {
+	parts := money.New(1000, "USD").Split(3)
+	expected := []int64{334, 333, 333}
+	if len(parts) != len(expected) {
+		t.Fatalf("Split(3) returned %d parts; expected 3", len(parts))
+	}
+	for i, part := range parts {
+		if part.Cents != expected[i] {
+			t.Errorf("Part %d = %s; expected %d cents", i, part, expected[i])
+		}
+	}
+
+	parts = money.New(-5, "USD").Split(2)
+	if parts[0].Cents != -3 || parts[1].Cents != -2 {
+		t.Errorf("Split(-0.05, 2) = %s, %s; expected -0.03, -0.02", parts[0], parts[1])
+	}
+}
+
+// TestMoneyJSON tests that amounts are sent as decimal numbers
+func TestMoneyJSON(t *testing.T) {
+	data, err := json.Marshal(struct {
+		Price money.Money `json:"price"`
+	}{money.New(1450, "USD")})
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if string(data) != `{"price":14.50}` {
+		t.Errorf("Marshal = %s; expected {\"price\":14.50}", data)
+	}
+
+	var decoded struct {
+		Price money.Money `json:"price"`
+	}
+	if err := json.Unmarshal([]byte(`{"price": 9.99}`), &decoded); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if decoded.Price.Cents != 999 {
+		t.Errorf("Unmarshal 9.99 = %d cents; expected 999", decoded.Price.Cents)
+	}
+}
+
+// TestMoneyScan tests reading DECIMAL columns
+func TestMoneyScan(t *testing.T) {
+	m := money.New(0, "EUR")
+	if err := m.Scan([]byte("25.98")); err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if m.Cents != 2598 || m.Currency != "EUR" {
+		t.Errorf("Scan(25.98) = %d %s; expected 2598 EUR", m.Cents, m.Currency)
+	}
+
+	value, err := m.Value()
+	if err != nil || value != "25.98" {
+		t.Errorf("Value() = %v, %v; expected 25.98", value, err)
+	}
+}
+
+// TestParseCurrency tests normalising configured currency codes
+func TestParseCurrency(t *testing.T) {
+	tests := map[string]string{"gbp": "GBP", " EUR ": "EUR", "": "USD", "dollars": "USD", "U$D": "USD"}
+	for in, expected := range tests {
+		if got := money.ParseCurrency(in); got != expected {
+			t.Errorf("ParseCurrency(%q) = %s; expected %s", in, got, expected)
+		}
+	}
+}
+
+// TestMoneyFormat tests writing amounts with their currency
+func TestMoneyFormat(t *testing.T) {
+	tests := map[money.Money]string{
+		money.New(1299, "USD"): "$12.99",
+		money.New(-350, "GBP"): "-£3.50",
+		money.New(5, "EUR"):    "€0.05",
+		money.New(1299, "CHF"): "CHF 12.99",
+		money.New(100, ""):     "$1.00",
+	}
+	for m, expected := range tests {
+		if got := m.Format(); got != expected {
+			t.Errorf("Format(%d %s) = %s; expected %s", m.Cents, m.Currency, got, expected)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package tests
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cinemabooking/money"
+	"cinemabooking/notifications"
+)
+
+// flakyMailer fails a set number of times before delivering
+type flakyMailer struct {
+	mu       sync.Mutex
+	failures int
+	attempts int
+	sent     []notifications.Message
+}
+
+func (m *flakyMailer) Send(msg notifications.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.attempts++
+	if m.attempts <= m.failures {
+		return errors.New("connection refused")
+	}
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+// TestEmailTemplates tests the booking email bodies
+func TestEmailTemplates(t *testing.T) {
+	booking := notifications.Booking{
+		ID:         42,
+		Reference:  "7GQ4M2KD",
+		Name:       "Ada",
+		Email:      "ada@example.com",
+		MovieTitle: "Inception",
+		Screen:     "Screen 1",
+		StartTime:  time.Date(2024, 3, 20, 19, 30, 0, 0, time.UTC),
+		Seats:      []string{"C4", "C5"},
+		Total:      money.New(2998, "USD"),
+	}
+
+	msg, err := notifications.BookingConfirmation(booking)
+	if err != nil {
+		t.Fatalf("Failed to render confirmation: %v", err)
+	}
+	if msg.To != "ada@example.com" || !strings.Contains(msg.Subject, "7GQ4M2KD") {
+		t.Errorf("Unexpected confirmation envelope: %+v", msg)
+	}
+	for _, want := range []string{"Hi Ada", "Inception", "Wednesday 20 March 2024 at 19:30", "Screen 1", "C4, C5", "$29.98"} {
+		if !strings.Contains(msg.Body, want) {
+			t.Errorf("Expected confirmation to contain %q, got:\n%s", want, msg.Body)
+		}
+	}
+
+	// Food and drink orders come with their pickup code
+	if strings.Contains(msg.Body, "pickup code") {
+		t.Errorf("Expected no pickup code without food and drink, got:\n%s", msg.Body)
+	}
+	withExtras := booking
+	withExtras.Extras = []string{"2 x Large Popcorn"}
+	withExtras.PickupCode = "K7MR3X"
+	msg, err = notifications.BookingConfirmation(withExtras)
+	if err != nil {
+		t.Fatalf("Failed to render confirmation: %v", err)
+	}
+	if !strings.Contains(msg.Body, "2 x Large Popcorn") || !strings.Contains(msg.Body, "pickup code K7MR3X") {
+		t.Errorf("Expected the food and drink order and pickup code, got:\n%s", msg.Body)
+	}
+
+	msg, err = notifications.BookingCancellation(booking, "Projector fault", money.New(2998, "USD"))
+	if err != nil {
+		t.Fatalf("Failed to render cancellation: %v", err)
+	}
+	if !strings.Contains(msg.Body, "Projector fault") || !strings.Contains(msg.Body, "refund of $29.98") {
+		t.Errorf("Unexpected cancellation body:\n%s", msg.Body)
+	}
+
+	// Customers without a name still get a greeting
+	booking.Name = ""
+	msg, err = notifications.ShowReminder(booking)
+	if err != nil {
+		t.Fatalf("Failed to render reminder: %v", err)
+	}
+	if !strings.HasPrefix(msg.Body, "Hi there,") || !strings.Contains(msg.Subject, "19:30") {
+		t.Errorf("Unexpected reminder: %+v", msg)
+	}
+}
+
+// TestSendQueueRetries tests that failed sends are retried until they succeed
+func TestSendQueueRetries(t *testing.T) {
+	transport := &flakyMailer{failures: 2}
+	queue := notifications.NewQueue(transport, 10, 1, 3, time.Millisecond)
+
+	var outcomes []error
+	msg := notifications.Message{To: "ada@example.com", Subject: "Hello", Done: func(err error) { outcomes = append(outcomes, err) }}
+	if err := queue.Send(msg); err != nil {
+		t.Fatalf("Failed to queue message: %v", err)
+	}
+	queue.Close()
+
+	if transport.attempts != 3 || len(transport.sent) != 1 {
+		t.Errorf("Expected delivery on the third attempt, got %d attempts and %d sent", transport.attempts, len(transport.sent))
+	}
+	if len(outcomes) != 1 || outcomes[0] != nil {
+		t.Errorf("Expected one successful outcome reported, got %v", outcomes)
+	}
+
+	// Nothing is accepted once the queue is closed
+	if err := queue.Send(notifications.Message{To: "ada@example.com"}); err != notifications.ErrQueueClosed {
+		t.Errorf("Expected ErrQueueClosed, got %v", err)
+	}
+}
+
+// TestSendQueueGivesUp tests that a message is dropped after the last attempt
+func TestSendQueueGivesUp(t *testing.T) {
+	transport := &flakyMailer{failures: 10}
+	queue := notifications.NewQueue(transport, 10, 1, 3, time.Millisecond)
+	var outcomes []error
+	queue.Send(notifications.Message{To: "ada@example.com", Done: func(err error) { outcomes = append(outcomes, err) }})
+	queue.Close()
+
+	if transport.attempts != 3 || len(transport.sent) != 0 {
+		t.Errorf("Expected 3 failed attempts, got %d attempts and %d sent", transport.attempts, len(transport.sent))
+	}
+	// Only the final failure is reported, so the sender can try again later
+	if len(outcomes) != 1 || outcomes[0] == nil {
+		t.Errorf("Expected one failed outcome reported, got %v", outcomes)
+	}
+}
+
+// TestOutboxMailer tests that messages are written to the outbox directory
+func TestOutboxMailer(t *testing.T) {
+	dir := t.TempDir()
+	outbox := notifications.OutboxMailer{Dir: filepath.Join(dir, "outbox"), From: "tickets@example.com"}
+
+	err := outbox.Send(notifications.Message{To: "ada@example.com", Subject: "Hello", Body: "Line one\nLine two"})
+	if err != nil {
+		t.Fatalf("Failed to write message: %v", err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "outbox", "*.eml"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("Expected one message in the outbox, got %v (%v)", files, err)
+	}
+	contents, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatalf("Failed to read message: %v", err)
+	}
+	for _, want := range []string{"From: tickets@example.com\r\n", "To: ada@example.com\r\n", "Subject: Hello\r\n", "Line one\r\nLine two"} {
+		if !strings.Contains(string(contents), want) {
+			t.Errorf("Expected message to contain %q, got:\n%s", want, contents)
+		}
+	}
+}
+
+// TestWaitlistOfferEmail tests the email offering held seats to a customer
+// on the waitlist
+func TestWaitlistOfferEmail(t *testing.T) {
+	start := time.Date(2024, 3, 20, 19, 30, 0, 0, time.UTC)
+	msg, err := notifications.WaitlistSeatsOffered(notifications.WaitlistOffer{
+		Name:       "Ada",
+		Email:      "ada@example.com",
+		MovieTitle: "Inception",
+		Screen:     "Screen 1",
+		StartTime:  start,
+		Seats:      []string{"D7", "D8"},
+		Link:       "https://cinema.example/show?id=5&hold=abc123",
+		Expires:    start.Add(-2 * time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("Failed to render waitlist offer: %v", err)
+	}
+	if msg.To != "ada@example.com" || !strings.Contains(msg.Subject, "Inception") {
+		t.Errorf("Unexpected waitlist offer envelope: %+v", msg)
+	}
+	for _, want := range []string{"Hi Ada", "Screen 1", "D7, D8", "until 17:30", "https://cinema.example/show?id=5&hold=abc123"} {
+		if !strings.Contains(msg.Body, want) {
+			t.Errorf("Expected waitlist offer to contain %q, got:\n%s", want, msg.Body)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package tests
+
+import (
+	"testing"
+
+	"cinemabooking/pagination"
+)
+
+// TestCursorRoundTrip tests that cursors decode to what was encoded
+func TestCursorRoundTrip(t *testing.T) {
+	title := "Inception"
+	cursor := pagination.Cursor{Sort: "title", Key: &title, ID: 2}
+
+	decoded, err := pagination.Decode(cursor.Encode(), "title")
+	if err != nil {
+		t.Fatalf("Failed to decode cursor: %v", err)
+	}
+	if decoded.ID != 2 || decoded.Key == nil || *decoded.Key != title {
+		t.Errorf("Expected cursor {title Inception 2}, got %+v", decoded)
+	}
+
+	// NULL sort keys survive the round trip
+	nullCursor := pagination.Cursor{Sort: "next_showtime", ID: 7}
+	decoded, err = pagination.Decode(nullCursor.Encode(), "next_showtime")
+	if err != nil || decoded.Key != nil {
+		t.Errorf("Expected a cursor with a nil key, got %+v (err %v)", decoded, err)
+	}
+
+	// A cursor can't be reused with another sort order
+	if _, err := pagination.Decode(cursor.Encode(), "rating"); err != pagination.ErrInvalidCursor {
+		t.Errorf("Expected ErrInvalidCursor for a different sort, got %v", err)
+	}
+
+	if _, err := pagination.Decode("not-a-cursor", "title"); err != pagination.ErrInvalidCursor {
+		t.Errorf("Expected ErrInvalidCursor for garbage input, got %v", err)
+	}
+}
@@ -0,0 +1,221 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"cinemabooking/money"
+	"cinemabooking/pricing"
+)
+
+func seatItems(n int, price money.Money) []pricing.Item {
+	var items []pricing.Item
+	for i := 0; i < n; i++ {
+		items = append(items, pricing.Item{Kind: pricing.KindSeat, Description: "Seat", Quantity: 1, UnitAmount: price, Amount: price})
+	}
+	return items
+}
+
+// findItems returns the items of a kind
+func findItems(items []pricing.Item, kind string) []pricing.Item {
+	var found []pricing.Item
+	for _, item := range items {
+		if item.Kind == kind {
+			found = append(found, item)
+		}
+	}
+	return found
+}
+
+// TestPricingInclusiveTax tests that tax included in prices is listed but
+// not added to the total
+func TestPricingInclusiveTax(t *testing.T) {
+	rules := pricing.Rules{Taxes: []pricing.Tax{{Name: "VAT", Rate: 20, Inclusive: true}}}
+	items := rules.Apply(seatItems(2, usd(1299)), pricing.Web)
+
+	taxes := findItems(items, pricing.KindTax)
+	if len(taxes) != 1 || taxes[0].Amount.Cents != 433 || !taxes[0].Included {
+		t.Fatalf("Expected 4.33 of included VAT, got %+v", taxes)
+	}
+	if taxes[0].Description != "VAT at 20%" {
+		t.Errorf("Tax description = %q; expected \"VAT at 20%%\"", taxes[0].Description)
+	}
+	if total := pricing.Total(items); total.Cents != 2598 {
+		t.Errorf("Total = %s; expected 25.98", total)
+	}
+}
+
+// TestPricingExclusiveTaxRounding tests rounding tax per line and on the total
+func TestPricingExclusiveTaxRounding(t *testing.T) {
+	perTotal := pricing.Rules{Taxes: []pricing.Tax{{Name: "Sales tax", Rate: 7.5}}}
+	items := perTotal.Apply(seatItems(3, usd(110)), pricing.Web)
+	if total := pricing.Total(items); total.Cents != 355 {
+		t.Errorf("Rounded on the total: %s; expected 3.30 + 0.25 = 3.55", total)
+	}
+
+	perLine := pricing.Rules{Taxes: []pricing.Tax{{Name: "Sales tax", Rate: 7.5, PerLine: true}}}
+	items = perLine.Apply(seatItems(3, usd(110)), pricing.Web)
+	if total := pricing.Total(items); total.Cents != 354 {
+		t.Errorf("Rounded per line: %s; expected 3.30 + 3 x 0.08 = 3.54", total)
+	}
+}
+
+// TestPricingRoundingModes tests rounding half a cent of tax
+func TestPricingRoundingModes(t *testing.T) {
+	tests := []struct {
+		rounding pricing.Rounding
+		tax      int64
+	}{
+		{pricing.HalfUp, 11},
+		{pricing.HalfEven, 10},
+		{pricing.Down, 10},
+		{pricing.Up, 11},
+	}
+
+	for _, test := range tests {
+		rules := pricing.Rules{Taxes: []pricing.Tax{{Name: "Tax", Rate: 10, Rounding: test.rounding}}}
+		taxes := findItems(rules.Apply(seatItems(1, usd(105)), pricing.Web), pricing.KindTax)
+		if len(taxes) != 1 || taxes[0].Amount.Cents != test.tax {
+			t.Errorf("%s: 10%% of 1.05 = %+v; expected %d cents", test.rounding, taxes, test.tax)
+		}
+	}
+}
+
+// TestPricingFees tests fees by channel, and taxes on them
+func TestPricingFees(t *testing.T) {
+	rules := pricing.Rules{
+		Fees: []pricing.Fee{
+			{Name: "Booking fee", Channel: pricing.Web, PerTicket: usd(150)},
+			{Name: "Counter fee", Channel: pricing.BoxOffice, PerTicket: usd(50)},
+			{Name: "Card handling", PerBooking: usd(100)},
+		},
+		Taxes: []pricing.Tax{{Name: "Sales tax", Rate: 10, Exempt: []string{pricing.KindFee}}},
+	}
+
+	items := rules.Apply(seatItems(2, usd(1000)), pricing.Web)
+	fees := findItems(items, pricing.KindFee)
+	if len(fees) != 2 || fees[0].Quantity != 2 || fees[0].Amount.Cents != 300 || fees[1].Amount.Cents != 100 {
+		t.Fatalf("Expected 2 x 1.50 booking fee and 1.00 card handling, got %+v", fees)
+	}
+	// 20.00 of seats + 4.00 of fees + 2.00 tax on the seats only
+	if total := pricing.Total(items); total.Cents != 2600 {
+		t.Errorf("Web total = %s; expected 26.00", total)
+	}
+
+	items = rules.Apply(seatItems(2, usd(1000)), pricing.BoxOffice)
+	if total := pricing.Total(items); total.Cents != 2400 {
+		t.Errorf("Box office total = %s; expected 24.00", total)
+	}
+
+	// Pricing again replaces the fees and taxes rather than adding more
+	again := rules.Apply(items, pricing.BoxOffice)
+	if total := pricing.Total(again); total.Cents != 2400 || len(again) != len(items) {
+		t.Errorf("Repriced total = %s with %d items; expected 24.00 with %d", total, len(again), len(items))
+	}
+}
+
+// TestPricingValidate tests rejecting rules that can't be applied
+func TestPricingValidate(t *testing.T) {
+	invalid := []pricing.Rules{
+		{Fees: []pricing.Fee{{Name: "", PerTicket: usd(100)}}},
+		{Fees: []pricing.Fee{{Name: "Fee", Channel: "phone"}}},
+		{Fees: []pricing.Fee{{Name: "Fee", PerTicket: usd(-100)}}},
+		{Taxes: []pricing.Tax{{Name: "VAT", Rate: 120}}},
+		{Taxes: []pricing.Tax{{Name: "VAT", Rate: 20, Rounding: "bankers"}}},
+		{Taxes: []pricing.Tax{{Name: "VAT", Rate: 20, Exempt: []string{"fees"}}}},
+		{Adjustments: []pricing.Adjustment{{Name: "Matinee", StartsFrom: "10am"}}},
+		{Adjustments: []pricing.Adjustment{{Name: "Cheap days", Days: []string{"Caturday"}}}},
+		{Adjustments: []pricing.Adjustment{{Name: "Free", Percent: -150}}},
+	}
+	for i, rules := range invalid {
+		if rules.Validate() == nil {
+			t.Errorf("Rules %d should be invalid", i)
+		}
+	}
+
+	valid := pricing.Rules{
+		Fees:  []pricing.Fee{{Name: "Booking fee", Channel: pricing.Web, PerTicket: usd(75)}},
+		Taxes: []pricing.Tax{{Name: "VAT", Rate: 20, Inclusive: true, Rounding: pricing.HalfEven, Exempt: []string{pricing.KindFee}}},
+	}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Valid rules rejected: %v", err)
+	}
+}
+
+// bound returns a pointer for an optional condition
+func bound(v float64) *float64 {
+	return &v
+}
+
+// TestPricingShowPrice tests adjusting a show's price to occupancy, time to
+// the show, day of the week and matinee windows
+func TestPricingShowPrice(t *testing.T) {
+	rules := pricing.Rules{Adjustments: []pricing.Adjustment{
+		{Name: "Busy", OccupancyFrom: bound(70), Percent: 20},
+		{Name: "Quiet", OccupancyBelow: bound(30), HoursBeforeBelow: bound(24), Percent: -10},
+		{Name: "Cheap Tuesday", Days: []string{"tue"}, Amount: usd(-200)},
+		{Name: "Matinee", StartsFrom: "10:00", StartsBefore: "17:00", Percent: -15},
+	}}
+	if err := rules.Validate(); err != nil {
+		t.Fatalf("Rules rejected: %v", err)
+	}
+
+	// Tuesday 14:00, and Saturday 20:00
+	matinee := time.Date(2026, 10, 20, 14, 0, 0, 0, time.UTC)
+	evening := time.Date(2026, 10, 24, 20, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		demand  pricing.Demand
+		cents   int64
+		applied int
+	}{
+		{"no adjustments", pricing.Demand{Occupancy: 50, Start: evening, At: evening.Add(-48 * time.Hour)}, 1000, 0},
+		{"busy", pricing.Demand{Occupancy: 70, Start: evening, At: evening.Add(-48 * time.Hour)}, 1200, 1},
+		{"quiet but days away", pricing.Demand{Occupancy: 10, Start: evening, At: evening.Add(-48 * time.Hour)}, 1000, 0},
+		{"quiet and soon", pricing.Demand{Occupancy: 10, Start: evening, At: evening.Add(-2 * time.Hour)}, 900, 1},
+		{"busy Tuesday matinee", pricing.Demand{Occupancy: 90, Start: matinee, At: matinee.Add(-48 * time.Hour)}, 850, 3},
+		{"quiet Tuesday matinee", pricing.Demand{Occupancy: 0, Start: matinee, At: matinee.Add(-time.Hour)}, 550, 3},
+	}
+	for _, tt := range tests {
+		price, applied := rules.ShowPrice(usd(1000), tt.demand)
+		if price.Cents != tt.cents || len(applied) != tt.applied {
+			t.Errorf("%s: price = %s with %d adjustments; expected %s with %d", tt.name, price, len(applied), usd(tt.cents), tt.applied)
+		}
+	}
+
+	// Prices never go below zero
+	free := pricing.Rules{Adjustments: []pricing.Adjustment{{Name: "Giveaway", Amount: usd(-5000)}}}
+	if price, _ := free.ShowPrice(usd(1000), pricing.Demand{Start: evening, At: evening}); !price.IsZero() {
+		t.Errorf("Price = %s; expected 0.00", price)
+	}
+}
+
+// TestPricingOffers tests signing a price offer and rejecting it once it has
+// expired or been tampered with
+func TestPricingOffers(t *testing.T) {
+	key := []byte("test-key")
+	now := time.Date(2026, 10, 19, 18, 0, 0, 0, time.UTC)
+	offer := pricing.Offer{ShowID: 7, Price: usd(1250), Expires: now.Add(10 * time.Minute)}
+
+	token, err := pricing.SignOffer(offer, key)
+	if err != nil {
+		t.Fatalf("Failed to sign offer: %v", err)
+	}
+	got, err := pricing.VerifyOffer(token, key, now)
+	if err != nil {
+		t.Fatalf("Failed to verify offer: %v", err)
+	}
+	if got.ShowID != 7 || got.Price != usd(1250) {
+		t.Errorf("Verified offer = %+v; expected show 7 at 12.50 USD", got)
+	}
+
+	if _, err := pricing.VerifyOffer(token, key, now.Add(10*time.Minute)); err != pricing.ErrInvalidOffer {
+		t.Errorf("Expired offer accepted")
+	}
+	if _, err := pricing.VerifyOffer(token, []byte("other-key"), now); err != pricing.ErrInvalidOffer {
+		t.Errorf("Offer signed with another key accepted")
+	}
+	if _, err := pricing.VerifyOffer(token+"x", key, now); err != pricing.ErrInvalidOffer {
+		t.Errorf("Tampered offer accepted")
+	}
+}
@@ -0,0 +1,88 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"cinemabooking/money"
+	"cinemabooking/schedule"
+)
+
+// TestExpandSchedule tests expanding a template into shows
+func TestExpandSchedule(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Skipf("Time zone data not available: %v", err)
+	}
+
+	template := schedule.Template{
+		MovieID:    1,
+		Screen:     "Screen 1",
+		Days:       []string{"fri", "sat"},
+		StartTimes: []string{"14:00", "19:30"},
+		From:       "2024-03-25",
+		To:         "2024-04-07",
+		Price:      money.New(1299, "USD"),
+	}
+
+	slots, err := schedule.Expand(template, 150*time.Minute, london)
+	if err != nil {
+		t.Fatalf("Failed to expand schedule: %v", err)
+	}
+
+	// Two Fridays and two Saturdays, two shows each
+	if len(slots) != 8 {
+		t.Fatalf("Expected 8 shows, got %d", len(slots))
+	}
+
+	for _, slot := range slots {
+		local := slot.Start.In(london)
+		if local.Weekday() != time.Friday && local.Weekday() != time.Saturday {
+			t.Errorf("Unexpected show on %s", local.Weekday())
+		}
+		if clock := local.Format("15:04"); clock != "14:00" && clock != "19:30" {
+			t.Errorf("Expected shows at 14:00 or 19:30 local time, got %s", clock)
+		}
+		if slot.End.Sub(slot.Start) != 150*time.Minute {
+			t.Errorf("Expected a 150 minute show, got %v", slot.End.Sub(slot.Start))
+		}
+	}
+
+	// The clocks went forward on 31 March, so the same wall-clock time is an
+	// hour earlier in UTC afterwards
+	if slots[0].Start.UTC().Hour() != 14 || slots[len(slots)-1].Start.UTC().Hour() != 18 {
+		t.Errorf("Expected UTC hours to follow DST, got %v and %v", slots[0].Start.UTC(), slots[len(slots)-1].Start.UTC())
+	}
+
+	template.Days = []string{"someday"}
+	if _, err := schedule.Expand(template, time.Hour, london); err == nil {
+		t.Error("Expected an error for an unknown day")
+	}
+}
+
+// TestScheduleConflicts tests clash detection with turnaround time
+func TestScheduleConflicts(t *testing.T) {
+	base := time.Date(2024, 3, 20, 14, 0, 0, 0, time.UTC)
+	slot := func(startHour, minutes int) schedule.Slot {
+		start := base.Add(time.Duration(startHour) * time.Hour)
+		return schedule.Slot{Start: start, End: start.Add(time.Duration(minutes) * time.Minute)}
+	}
+
+	slots := []schedule.Slot{slot(0, 120), slot(2, 120), slot(6, 120)}
+	existing := []schedule.Slot{slot(5, 90)}
+
+	// With no turnaround back-to-back shows are fine
+	internal, external := schedule.Conflicts(slots, existing, 0)
+	if len(internal) != 0 {
+		t.Errorf("Expected no clashes between back-to-back shows, got %v", internal)
+	}
+	if len(external[2]) != 1 {
+		t.Errorf("Expected the third show to clash with the existing one, got %v", external)
+	}
+
+	// A 15 minute turnaround makes back-to-back shows clash
+	internal, _ = schedule.Conflicts(slots, existing, 15*time.Minute)
+	if len(internal[1]) != 1 || internal[1][0] != 0 {
+		t.Errorf("Expected the second show to clash with the first, got %v", internal)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/gorilla/mux"
 	_ "cinemabooking/db"
 	"cinemabooking/models"
+	"cinemabooking/money"
 	"cinemabooking/handlers"
 	"time"
 	"encoding/json"
@@ -25,7 +26,7 @@ func TestSeatAvailability(t *testing.T) {
 		Screen:    "Screen 1",
 		StartTime: time.Now().Add(24 * time.Hour),
 		EndTime:   time.Now().Add(26 * time.Hour),
-		Price:     10.00,
+		Price:     money.New(1000, "USD"),
 	}
 
 	result, err := testDB.Exec(`
@@ -0,0 +1,36 @@
+package tests
+
+import (
+	"testing"
+
+	"cinemabooking/seating"
+)
+
+// TestSamePlaces tests matching a booking's seats on another show
+func TestSamePlaces(t *testing.T) {
+	rows := seatGrid(3, 5)
+	places := []seating.Place{{Row: "B", Number: 2}, {Row: "B", Number: 3}}
+
+	seats, ok := seating.SamePlaces(rows, places)
+	if !ok {
+		t.Fatal("Expected the same seats to be free")
+	}
+	if len(seats) != 2 || seats[0].ID != 7 || seats[1].ID != 8 {
+		t.Errorf("Expected seats 7 and 8, got %+v", seats)
+	}
+
+	// One taken seat means the positions can't be kept
+	rows[1].Seats[2].Free = false
+	if _, ok := seating.SamePlaces(rows, places); ok {
+		t.Error("Expected no match when a seat is taken")
+	}
+
+	// Positions missing from the other screen don't match either
+	if _, ok := seating.SamePlaces(rows, []seating.Place{{Row: "F", Number: 1}}); ok {
+		t.Error("Expected no match for a seat that doesn't exist")
+	}
+
+	if _, ok := seating.SamePlaces(rows, nil); ok {
+		t.Error("Expected no match for an empty booking")
+	}
+}
@@ -0,0 +1,62 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+
+	"cinemabooking/seating"
+)
+
+// seatRow builds a row of numbered seats, marking the given numbers as taken
+func seatRow(name string, size int, taken ...int) seating.Row {
+	takenSet := make(map[int]bool)
+	for _, n := range taken {
+		takenSet[n] = true
+	}
+	row := seating.Row{Name: name}
+	for n := 1; n <= size; n++ {
+		row.Seats = append(row.Seats, seating.Seat{ID: n, Number: n, Free: !takenSet[n]})
+	}
+	return row
+}
+
+// TestNoSingleGapRule tests that selections leaving an orphan seat are rejected
+func TestNoSingleGapRule(t *testing.T) {
+	engine := seating.NewEngine(seating.NoSingleGap{})
+
+	tests := []struct {
+		name     string
+		row      seating.Row
+		selected []int
+		wantErr  bool
+	}{
+		{"block from the aisle", seatRow("A", 10), []int{1, 2, 3}, false},
+		{"gap next to the aisle", seatRow("A", 10), []int{2, 3}, true},
+		{"gap between bookings", seatRow("A", 10, 1, 2), []int{4, 5}, true},
+		{"fills an existing gap", seatRow("A", 10, 1, 2, 4), []int{3}, false},
+		{"existing orphan is ignored", seatRow("A", 10, 2), []int{5, 6}, false},
+		{"whole row", seatRow("A", 3), []int{1, 2, 3}, false},
+		{"middle of an empty row", seatRow("A", 10), []int{5, 6}, false},
+	}
+
+	for _, tt := range tests {
+		err := engine.Evaluate([]seating.Row{tt.row}, tt.selected)
+		if tt.wantErr && err == nil {
+			t.Errorf("%s: expected a violation, got none", tt.name)
+		}
+		if !tt.wantErr && err != nil {
+			t.Errorf("%s: unexpected violation: %v", tt.name, err)
+		}
+
+		var violation *seating.Violation
+		if err != nil && !errors.As(err, &violation) {
+			t.Errorf("%s: expected a *seating.Violation, got %T", tt.name, err)
+		}
+	}
+
+	// Rows without a selected seat are not checked
+	untouched := seatRow("B", 10, 1, 3)
+	if err := engine.Evaluate([]seating.Row{untouched}, []int{99}); err != nil {
+		t.Errorf("Expected untouched row to pass, got %v", err)
+	}
+}
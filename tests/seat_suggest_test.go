@@ -0,0 +1,67 @@
+package tests
+
+import (
+	"testing"
+
+	"cinemabooking/seating"
+)
+
+// seatGrid builds rows A.. of the given width with every seat free
+func seatGrid(rowCount, width int) []seating.Row {
+	var rows []seating.Row
+	id := 1
+	for r := 0; r < rowCount; r++ {
+		row := seating.Row{Name: string(rune('A' + r))}
+		for n := 1; n <= width; n++ {
+			row.Seats = append(row.Seats, seating.Seat{ID: id, Number: n, Free: true, Category: "standard"})
+			id++
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// TestSuggestSeats tests the best-available block scoring
+func TestSuggestSeats(t *testing.T) {
+	rows := seatGrid(5, 10)
+
+	// An empty house puts a couple in the middle of the sweet-spot row
+	block, ok := seating.Suggest(rows, seating.Preferences{PartySize: 2}, seating.DefaultWeights, nil)
+	if !ok {
+		t.Fatal("Expected a suggestion for an empty house")
+	}
+	if block.Row != "D" || block.Seats[0].Number != 5 || block.Seats[1].Number != 6 {
+		t.Errorf("Expected D5-D6, got %s%d-%d", block.Row, block.Seats[0].Number, block.Seats[len(block.Seats)-1].Number)
+	}
+
+	// Preferred rows win over the default sweet spot
+	block, ok = seating.Suggest(rows, seating.Preferences{PartySize: 2, PreferredRows: []string{"A"}}, seating.DefaultWeights, nil)
+	if !ok || block.Row != "A" {
+		t.Errorf("Expected a block in row A, got %q", block.Row)
+	}
+
+	// Accessible parties need at least one accessible seat
+	rows[1].Seats[0].Accessible = true
+	block, ok = seating.Suggest(rows, seating.Preferences{PartySize: 2, Accessible: true}, seating.DefaultWeights, nil)
+	if !ok || block.Row != "B" || block.Seats[0].Number != 1 {
+		t.Errorf("Expected B1-B2 for an accessible party, got %s%v", block.Row, block.Seats)
+	}
+
+	// Blocks that break the seating rules are skipped
+	rules := seating.NewEngine(seating.NoSingleGap{})
+	narrow := []seating.Row{{Name: "A", Seats: []seating.Seat{
+		{ID: 1, Number: 1, Free: true},
+		{ID: 2, Number: 2, Free: true},
+		{ID: 3, Number: 3, Free: true},
+		{ID: 4, Number: 4, Free: false},
+	}}}
+	block, ok = seating.Suggest(narrow, seating.Preferences{PartySize: 2}, seating.DefaultWeights, rules)
+	if ok {
+		t.Errorf("Expected no suggestion that leaves an orphan seat, got %v", block.Seats)
+	}
+
+	// Parties larger than any run get nothing
+	if _, ok := seating.Suggest(rows, seating.Preferences{PartySize: 11}, seating.DefaultWeights, nil); ok {
+		t.Error("Expected no suggestion for a party wider than the row")
+	}
+}
@@ -0,0 +1,72 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"cinemabooking/tickets"
+)
+
+// TestTicketSignature tests signing and verifying ticket payloads
+func TestTicketSignature(t *testing.T) {
+	key := []byte("test-signing-key")
+	payload := tickets.Payload{BookingID: 42, ShowID: 7, Seats: []string{"C4", "C5"}}
+
+	ticket, err := tickets.Sign(payload, key)
+	if err != nil {
+		t.Fatalf("Failed to sign ticket: %v", err)
+	}
+	if !strings.HasPrefix(ticket, "CT1.") {
+		t.Errorf("Expected a CT1 ticket, got %q", ticket)
+	}
+
+	got, err := tickets.Verify(ticket, key)
+	if err != nil {
+		t.Fatalf("Failed to verify ticket: %v", err)
+	}
+	if got.BookingID != 42 || got.ShowID != 7 || len(got.Seats) != 2 || got.Seats[1] != "C5" {
+		t.Errorf("Unexpected payload: %+v", got)
+	}
+
+	// A different key doesn't verify
+	if _, err := tickets.Verify(ticket, []byte("other-key")); err != tickets.ErrInvalidTicket {
+		t.Errorf("Expected ErrInvalidTicket for the wrong key, got %v", err)
+	}
+
+	// Nor does a ticket whose payload was swapped
+	other, _ := tickets.Sign(tickets.Payload{BookingID: 43, ShowID: 7}, key)
+	parts, otherParts := strings.Split(ticket, "."), strings.Split(other, ".")
+	forged := parts[0] + "." + otherParts[1] + "." + parts[2]
+	if _, err := tickets.Verify(forged, key); err != tickets.ErrInvalidTicket {
+		t.Errorf("Expected ErrInvalidTicket for a tampered ticket, got %v", err)
+	}
+
+	for _, bad := range []string{"", "CT1", "CT1.abc", "XX1." + parts[1] + "." + parts[2]} {
+		if _, err := tickets.Verify(bad, key); err != tickets.ErrInvalidTicket {
+			t.Errorf("Expected ErrInvalidTicket for %q, got %v", bad, err)
+		}
+	}
+}
+
+// TestCheckinWindow tests when tickets for a show can be scanned
+func TestCheckinWindow(t *testing.T) {
+	window := tickets.Window{Opens: time.Hour, Closes: 30 * time.Minute}
+	start := time.Date(2024, 3, 20, 19, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		now  time.Time
+		want error
+	}{
+		{start.Add(-2 * time.Hour), tickets.ErrTooEarly},
+		{start.Add(-time.Hour), nil},
+		{start, nil},
+		{start.Add(30 * time.Minute), nil},
+		{start.Add(31 * time.Minute), tickets.ErrTooLate},
+	}
+	for _, c := range cases {
+		if got := window.Check(start, c.now); got != c.want {
+			t.Errorf("Check at %s: expected %v, got %v", c.now.Format("15:04"), c.want, got)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package tests
+
+import (
+	"testing"
+
+	"cinemabooking/money"
+	"cinemabooking/vouchers"
+)
+
+// TestVoucherCodes tests generating, printing and reading back voucher codes
+func TestVoucherCodes(t *testing.T) {
+	code, err := vouchers.NewCode()
+	if err != nil {
+		t.Fatalf("Error generating code: %v", err)
+	}
+	if len(code) != vouchers.Length {
+		t.Fatalf("Expected a %d character code, got %q", vouchers.Length, code)
+	}
+
+	printed := vouchers.Format(code)
+	if len(printed) != vouchers.Length+3 {
+		t.Errorf("Expected the code in four groups, got %q", printed)
+	}
+	parsed, err := vouchers.ParseCode(printed)
+	if err != nil || parsed != code {
+		t.Errorf("Expected %q to parse back to %q, got %q (%v)", printed, code, parsed, err)
+	}
+
+	parsed, err = vouchers.ParseCode("abcd-efgh-jkmn-pqOI")
+	if err != nil || parsed != "ABCDEFGHJKMNPQ01" {
+		t.Errorf("Expected a lower case code with O and I to be normalised, got %q (%v)", parsed, err)
+	}
+	if _, err := vouchers.ParseCode("ABCD-EFGH-JKMN-PQU0"); err != vouchers.ErrInvalidCode {
+		t.Errorf("Expected ErrInvalidCode for a U, got %v", err)
+	}
+	if _, err := vouchers.ParseCode("ABCD-EFGH"); err != vouchers.ErrInvalidCode {
+		t.Errorf("Expected ErrInvalidCode for a short code, got %v", err)
+	}
+}
+
+// TestVoucherApply tests full and partial payment with a voucher
+func TestVoucherApply(t *testing.T) {
+	tests := []struct {
+		balance, due       int64
+		applied, remaining int64
+	}{
+		{balance: 5000, due: 2598, applied: 2598, remaining: 0},
+		{balance: 1000, due: 2598, applied: 1000, remaining: 1598},
+		{balance: 0, due: 1299, applied: 0, remaining: 1299},
+	}
+
+	for _, test := range tests {
+		applied, remaining := vouchers.Apply(money.New(test.balance, "USD"), money.New(test.due, "USD"))
+		if applied.Cents != test.applied || remaining.Cents != test.remaining {
+			t.Errorf("Apply(%d, %d) = %s, %s; expected %d, %d",
+				test.balance, test.due, applied, remaining, test.applied, test.remaining)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"cinemabooking/tickets"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// Width and height of ticket QR codes in pixels
+const ticketQRSize = 256
+
+// ticketKey signs e-tickets. Scanners are configured with the same key.
+func ticketKey() []byte {
+	return []byte(os.Getenv("TICKET_SIGNING_KEY"))
+}
+
+// Serve a booking's e-ticket: a QR code of its signed ticket payload
+func getTicket(w http.ResponseWriter, r *http.Request) {
+	bookingID, ok := authorizeBooking(w, r)
+	if !ok {
+		return
+	}
+
+	key := ticketKey()
+	if len(key) == 0 {
+		log.Printf("TICKET_SIGNING_KEY is not set, can't issue tickets")
+		http.Error(w, "Tickets are not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	payload, err := ticketPayload(dbConn, bookingID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Booking not found", http.StatusNotFound)
+		return
+	}
+	if err == errBookingNotConfirmed {
+		http.Error(w, "Booking is not confirmed", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching booking %d for ticket: %v", bookingID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	png, err := ticketQRCode(payload, key)
+	if err != nil {
+		log.Printf("Error creating ticket for booking %d: %v", bookingID, err)
+		http.Error(w, "Error creating ticket", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Write(png)
+}
+
+// ticketPayload loads what a confirmed booking's ticket admits
+func ticketPayload(q queryer, bookingID int) (tickets.Payload, error) {
+	payload := tickets.Payload{BookingID: bookingID}
+
+	var status string
+	err := q.QueryRow("SELECT COALESCE(reference, ''), show_id, status FROM bookings WHERE id = ?", bookingID).Scan(&payload.Reference, &payload.ShowID, &status)
+	if err != nil {
+		return payload, err
+	}
+	if status != "confirmed" {
+		return payload, errBookingNotConfirmed
+	}
+
+	rows, err := q.Query("SELECT row_name, seat_number FROM seats WHERE booking_id = ? ORDER BY row_name, seat_number", bookingID)
+	if err != nil {
+		return payload, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var rowName string
+		var seatNumber int
+		if err := rows.Scan(&rowName, &seatNumber); err != nil {
+			return payload, err
+		}
+		payload.Seats = append(payload.Seats, rowName+strconv.Itoa(seatNumber))
+	}
+	return payload, rows.Err()
+}
+
+// ticketQRCode signs a ticket payload and renders it as a QR code PNG
+func ticketQRCode(payload tickets.Payload, key []byte) ([]byte, error) {
+	ticket, err := tickets.Sign(payload, key)
+	if err != nil {
+		return nil, err
+	}
+	return qrcode.Encode(ticket, qrcode.Medium, ticketQRSize)
+}
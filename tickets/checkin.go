@@ -0,0 +1,31 @@
+package tickets
+
+import (
+	"errors"
+	"time"
+)
+
+// Errors returned for tickets scanned outside the check-in window
+var (
+	ErrTooEarly = errors.New("tickets: check-in has not opened yet")
+	ErrTooLate  = errors.New("tickets: check-in has closed")
+)
+
+// Window is when a show's tickets can be scanned: from Opens before the show
+// starts until Closes after it started.
+type Window struct {
+	Opens  time.Duration
+	Closes time.Duration
+}
+
+// Check reports whether a ticket for a show starting at start can be scanned
+// at now.
+func (w Window) Check(start, now time.Time) error {
+	if now.Before(start.Add(-w.Opens)) {
+		return ErrTooEarly
+	}
+	if now.After(start.Add(w.Closes)) {
+		return ErrTooLate
+	}
+	return nil
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"cinemabooking/auth"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/gorilla/mux"
+)
+
+// Name of the cookie holding the session token
+const sessionCookie = "session"
+
+// How long a login lasts
+const sessionLifetime = 30 * 24 * time.Hour
+
+// User is a registered customer
+type User struct {
+	ID    int       `json:"id"`
+	Name  string    `json:"name"`
+	Email string    `json:"email"`
+	Role  auth.Role `json:"role"`
+}
+
+// sessionToken reads the session token from the Authorization header or the
+// session cookie
+func sessionToken(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimPrefix(header, "Bearer ")
+	}
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// currentUser returns the logged-in user, or nil for guests
+func currentUser(r *http.Request) (*User, error) {
+	token := sessionToken(r)
+	if token == "" {
+		return nil, nil
+	}
+
+	var user User
+	err := dbConn.QueryRow(`
+		SELECT u.id, COALESCE(u.name, ''), u.email, u.role
+		FROM sessions s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.token_hash = ? AND s.expires_at > ? AND u.deleted_at IS NULL
+	`, auth.HashSessionToken(token), time.Now().UTC()).Scan(&user.ID, &user.Name, &user.Email, &user.Role)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// Register a customer account
+func registerUser(w http.ResponseWriter, r *http.Request) {
+	var registerRequest struct {
+		Name     string `json:"name"`
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&registerRequest)
+	if err != nil {
+		log.Printf("Error decoding request: %v", err)
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	email := strings.ToLower(strings.TrimSpace(registerRequest.Email))
+	if _, err := mail.ParseAddress(email); err != nil {
+		http.Error(w, "A valid email address is required", http.StatusBadRequest)
+		return
+	}
+	hash, err := auth.HashPassword(registerRequest.Password)
+	if err == auth.ErrWeakPassword {
+		http.Error(w, "Password must be at least 8 characters", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Error hashing password: %v", err)
+		http.Error(w, "Error creating account", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now().UTC()
+	result, err := dbConn.Exec(`
+		INSERT INTO users (created_at, updated_at, email, password, name)
+		VALUES (?, ?, ?, ?, ?)
+	`, now, now, email, hash, registerRequest.Name)
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == errDuplicateEntry {
+		http.Error(w, "An account with this email already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error creating user: %v", err)
+		http.Error(w, "Error creating account", http.StatusInternalServerError)
+		return
+	}
+	userID, err := result.LastInsertId()
+	if err != nil {
+		log.Printf("Error getting user ID: %v", err)
+		http.Error(w, "Error creating account", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Registered user %d", userID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(User{ID: int(userID), Name: registerRequest.Name, Email: email, Role: auth.RoleCustomer})
+}
+
+// Log in, starting a session
+func login(w http.ResponseWriter, r *http.Request) {
+	var loginRequest struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&loginRequest)
+	if err != nil {
+		log.Printf("Error decoding request: %v", err)
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	var user User
+	var hash string
+	err = dbConn.QueryRow(`
+		SELECT id, COALESCE(name, ''), email, role, password FROM users
+		WHERE email = ? AND deleted_at IS NULL
+	`, strings.ToLower(strings.TrimSpace(loginRequest.Email))).Scan(&user.ID, &user.Name, &user.Email, &user.Role, &hash)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Error fetching user: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if err == sql.ErrNoRows || !auth.CheckPassword(hash, loginRequest.Password) {
+		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
+		return
+	}
+
+	token, err := auth.NewSessionToken()
+	if err != nil {
+		log.Printf("Error creating session token: %v", err)
+		http.Error(w, "Error logging in", http.StatusInternalServerError)
+		return
+	}
+	expiresAt := time.Now().UTC().Add(sessionLifetime)
+	_, err = dbConn.Exec(`
+		INSERT INTO sessions (token_hash, user_id, expires_at) VALUES (?, ?, ?)
+	`, auth.HashSessionToken(token), user.ID, expiresAt)
+	if err != nil {
+		log.Printf("Error creating session: %v", err)
+		http.Error(w, "Error logging in", http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  expiresAt,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+		User      User      `json:"user"`
+	}{token, inCinemaTime(expiresAt), user})
+}
+
+// Log out, ending the current session
+func logout(w http.ResponseWriter, r *http.Request) {
+	if token := sessionToken(r); token != "" {
+		_, err := dbConn.Exec("DELETE FROM sessions WHERE token_hash = ?", auth.HashSessionToken(token))
+		if err != nil {
+			log.Printf("Error deleting session: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: "", Path: "/", MaxAge: -1, HttpOnly: true})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// List the logged-in user's bookings
+func getMyBookings(w http.ResponseWriter, r *http.Request) {
+	user, err := currentUser(r)
+	if err != nil {
+		log.Printf("Error fetching session: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if user == nil {
+		http.Error(w, "Login required", http.StatusUnauthorized)
+		return
+	}
+
+	rows, err := dbConn.Query(`
+		SELECT id, reference, show_id, user_name, user_email, total_amount, booking_time, status
+		FROM bookings
+		WHERE user_id = ?
+		ORDER BY booking_time DESC
+	`, user.ID)
+	if err != nil {
+		log.Printf("Error fetching bookings: %v", err)
+		http.Error(w, "Error fetching bookings", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	bookings := []Booking{}
+	index := make(map[int]int)
+	for rows.Next() {
+		var booking Booking
+		if err := rows.Scan(&booking.ID, &booking.Reference, &booking.ShowID, &booking.UserName, &booking.UserEmail, &booking.TotalAmount, &booking.BookingTime, &booking.Status); err != nil {
+			log.Printf("Error scanning booking: %v", err)
+			continue
+		}
+		booking.BookingTime = inCinemaTime(booking.BookingTime)
+		booking.SeatIDs = []int{}
+		index[booking.ID] = len(bookings)
+		bookings = append(bookings, booking)
+	}
+
+	seatRows, err := dbConn.Query(`
+		SELECT s.booking_id, s.id
+		FROM seats s
+		JOIN bookings b ON b.id = s.booking_id
+		WHERE b.user_id = ?
+	`, user.ID)
+	if err != nil {
+		log.Printf("Error fetching seats for bookings: %v", err)
+		http.Error(w, "Error fetching seats", http.StatusInternalServerError)
+		return
+	}
+	defer seatRows.Close()
+	for seatRows.Next() {
+		var bookingID, seatID int
+		if err := seatRows.Scan(&bookingID, &seatID); err != nil {
+			log.Printf("Error scanning seat ID: %v", err)
+			continue
+		}
+		if i, ok := index[bookingID]; ok {
+			bookings[i].SeatIDs = append(bookings[i].SeatIDs, seatID)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(bookings)
+}
+
+// List user accounts
+func listUsers(w http.ResponseWriter, r *http.Request) {
+	rows, err := dbConn.Query(`
+		SELECT id, COALESCE(name, ''), email, role FROM users
+		WHERE deleted_at IS NULL
+		ORDER BY id
+	`)
+	if err != nil {
+		log.Printf("Error fetching users: %v", err)
+		http.Error(w, "Error fetching users", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.Role); err != nil {
+			log.Printf("Error scanning user: %v", err)
+			continue
+		}
+		users = append(users, user)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(users)
+}
+
+// Change a user's role
+func setUserRole(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	var roleRequest struct {
+		Role string `json:"role"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&roleRequest)
+	if err != nil {
+		log.Printf("Error decoding request: %v", err)
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	role, err := auth.ParseRole(roleRequest.Role)
+	if err != nil {
+		http.Error(w, "Unknown role", http.StatusBadRequest)
+		return
+	}
+
+	result, err := dbConn.Exec("UPDATE users SET role = ?, updated_at = ? WHERE id = ? AND deleted_at IS NULL", role, time.Now().UTC(), userID)
+	if err != nil {
+		log.Printf("Error updating user %d: %v", userID, err)
+		http.Error(w, "Error updating user", http.StatusInternalServerError)
+		return
+	}
+
+	var user User
+	err = dbConn.QueryRow("SELECT id, COALESCE(name, ''), email, role FROM users WHERE id = ? AND deleted_at IS NULL", userID).Scan(&user.ID, &user.Name, &user.Email, &user.Role)
+	if err == sql.ErrNoRows {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching user %d: %v", userID, err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		log.Printf("User %d is now %s", userID, role)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
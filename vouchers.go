@@ -0,0 +1,429 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"cinemabooking/money"
+	"cinemabooking/vouchers"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/gorilla/mux"
+)
+
+var (
+	errVoucherNotFound = errors.New("voucher not found")
+	errVoucherExpired  = errors.New("voucher has expired")
+	errVoucherEmpty    = errors.New("voucher has no balance left")
+)
+
+// Voucher is a gift voucher with the balance left to spend
+type Voucher struct {
+	Code         string      `json:"code"`
+	InitialValue money.Money `json:"initial_value"`
+	Balance      money.Money `json:"balance"`
+	IssuedAt     time.Time   `json:"issued_at"`
+	ExpiresAt    *time.Time  `json:"expires_at,omitempty"`
+	Note         string      `json:"note,omitempty"`
+	// Only listed for staff
+	Transactions []VoucherTransaction `json:"transactions,omitempty"`
+}
+
+// VoucherTransaction is an entry in the voucher ledger. Amounts are positive
+// when they add to the balance and negative when they spend it.
+type VoucherTransaction struct {
+	ID               int         `json:"id"`
+	VoucherCode      string      `json:"voucher_code"`
+	Kind             string      `json:"kind"`
+	Amount           money.Money `json:"amount"`
+	BalanceAfter     money.Money `json:"balance_after"`
+	BookingReference *string     `json:"booking_reference,omitempty"`
+	CreatedAt        time.Time   `json:"created_at"`
+}
+
+// Issue a voucher with a new code
+func issueVoucher(w http.ResponseWriter, r *http.Request) {
+	var issueRequest struct {
+		Value     money.Money `json:"value"`
+		ExpiresAt string      `json:"expires_at"`
+		Note      string      `json:"note"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&issueRequest)
+	if err != nil {
+		log.Printf("Error decoding request: %v", err)
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	if !issueRequest.Value.IsPositive() {
+		http.Error(w, "Voucher value must be positive", http.StatusBadRequest)
+		return
+	}
+	value := money.New(issueRequest.Value.Cents, cinemaCurrency())
+
+	// Vouchers run to the end of their expiry date in the cinema's time zone
+	var expiresAt *time.Time
+	if issueRequest.ExpiresAt != "" {
+		day, err := time.ParseInLocation("2006-01-02", issueRequest.ExpiresAt, cinemaLocation)
+		if err != nil {
+			http.Error(w, "expires_at must be a date (YYYY-MM-DD)", http.StatusBadRequest)
+			return
+		}
+		end := day.AddDate(0, 0, 1).UTC()
+		expiresAt = &end
+	}
+
+	tx, err := dbConn.Begin()
+	if err != nil {
+		log.Printf("Error beginning transaction: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	issuedAt := time.Now().UTC()
+	var code string
+	var voucherID int64
+	for attempt := 0; attempt < referenceAttempts && voucherID == 0; attempt++ {
+		code, err = vouchers.NewCode()
+		if err != nil {
+			break
+		}
+		var result sql.Result
+		result, err = tx.Exec(`
+			INSERT INTO vouchers (code, initial_value, balance, issued_at, expires_at, note)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, code, value, value, issuedAt, expiresAt, issueRequest.Note)
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == errDuplicateEntry {
+			continue
+		}
+		if err != nil {
+			break
+		}
+		voucherID, err = result.LastInsertId()
+	}
+	if err == nil && voucherID == 0 {
+		err = errors.New("no unused voucher code found")
+	}
+	if err == nil {
+		err = recordVoucherTx(tx, int(voucherID), nil, "issue", value, value)
+	}
+	if err != nil {
+		log.Printf("Error issuing voucher: %v", err)
+		http.Error(w, "Error issuing voucher", http.StatusInternalServerError)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Issued voucher %d worth %s", voucherID, value)
+
+	voucher := Voucher{
+		Code:         vouchers.Format(code),
+		InitialValue: value,
+		Balance:      value,
+		IssuedAt:     inCinemaTime(issuedAt),
+		Note:         issueRequest.Note,
+	}
+	if expiresAt != nil {
+		expires := inCinemaTime(*expiresAt)
+		voucher.ExpiresAt = &expires
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(voucher)
+}
+
+// Check the balance of a voucher
+func getVoucherBalance(w http.ResponseWriter, r *http.Request) {
+	writeVoucher(w, mux.Vars(r)["code"], false)
+}
+
+// Show a voucher with its ledger entries
+func getVoucherLedger(w http.ResponseWriter, r *http.Request) {
+	writeVoucher(w, mux.Vars(r)["code"], true)
+}
+
+// writeVoucher looks up a voucher by code and writes it as JSON
+func writeVoucher(w http.ResponseWriter, code string, withTransactions bool) {
+	code, err := vouchers.ParseCode(code)
+	if err != nil {
+		http.Error(w, "Voucher not found", http.StatusNotFound)
+		return
+	}
+
+	var voucher Voucher
+	var voucherID int
+	var expiresAt sql.NullTime
+	err = dbConn.QueryRow(`
+		SELECT id, code, initial_value, balance, issued_at, expires_at, COALESCE(note, '')
+		FROM vouchers
+		WHERE code = ?
+	`, code).Scan(&voucherID, &voucher.Code, &voucher.InitialValue, &voucher.Balance, &voucher.IssuedAt, &expiresAt, &voucher.Note)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Voucher not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching voucher: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	voucher.Code = vouchers.Format(voucher.Code)
+	voucher.IssuedAt = inCinemaTime(voucher.IssuedAt)
+	if expiresAt.Valid {
+		expires := inCinemaTime(expiresAt.Time)
+		voucher.ExpiresAt = &expires
+	}
+
+	if withTransactions {
+		voucher.Transactions, err = voucherTransactions(voucherID, 0)
+		if err != nil {
+			log.Printf("Error fetching voucher transactions: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+	} else {
+		voucher.Note = ""
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(voucher)
+}
+
+// Default and largest page of the voucher ledger
+const (
+	defaultLedgerLimit = 100
+	maxLedgerLimit     = 1000
+)
+
+// List voucher transactions, newest first
+func listVoucherTransactions(w http.ResponseWriter, r *http.Request) {
+	limit := defaultLedgerLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxLedgerLimit {
+			http.Error(w, "limit must be between 1 and "+strconv.Itoa(maxLedgerLimit), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	transactions, err := voucherTransactions(0, limit)
+	if err != nil {
+		log.Printf("Error fetching voucher transactions: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(transactions)
+}
+
+// voucherTransactions lists the ledger of one voucher, or of every voucher
+// when voucherID is 0. A limit of 0 returns every entry.
+func voucherTransactions(voucherID, limit int) ([]VoucherTransaction, error) {
+	query := `
+		SELECT t.id, v.code, t.kind, t.amount, t.balance_after, b.reference, t.created_at
+		FROM voucher_transactions t
+		JOIN vouchers v ON v.id = t.voucher_id
+		LEFT JOIN bookings b ON b.id = t.booking_id
+	`
+	var args []interface{}
+	if voucherID != 0 {
+		query += " WHERE t.voucher_id = ?"
+		args = append(args, voucherID)
+	}
+	query += " ORDER BY t.id DESC"
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+
+	rows, err := dbConn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transactions := []VoucherTransaction{}
+	for rows.Next() {
+		var t VoucherTransaction
+		if err := rows.Scan(&t.ID, &t.VoucherCode, &t.Kind, &t.Amount, &t.BalanceAfter, &t.BookingReference, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		t.VoucherCode = vouchers.Format(t.VoucherCode)
+		t.CreatedAt = inCinemaTime(t.CreatedAt)
+		transactions = append(transactions, t)
+	}
+	return transactions, rows.Err()
+}
+
+// recordVoucherTx adds an entry to the voucher ledger
+func recordVoucherTx(tx *sql.Tx, voucherID int, bookingID *int, kind string, amount, balanceAfter money.Money) error {
+	_, err := tx.Exec(`
+		INSERT INTO voucher_transactions (voucher_id, booking_id, kind, amount, balance_after, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, voucherID, bookingID, kind, amount, balanceAfter, time.Now().UTC())
+	return err
+}
+
+// redeemVoucherTx pays as much of the amount due on a booking as the voucher's
+// balance allows, and returns the amount taken from the voucher
+func redeemVoucherTx(tx *sql.Tx, code string, bookingID int, due money.Money) (money.Money, error) {
+	none := noMoney()
+	code, err := vouchers.ParseCode(code)
+	if err != nil {
+		return none, errVoucherNotFound
+	}
+
+	var voucherID int
+	balance := noMoney()
+	var expiresAt sql.NullTime
+	err = tx.QueryRow("SELECT id, balance, expires_at FROM vouchers WHERE code = ? FOR UPDATE", code).Scan(&voucherID, &balance, &expiresAt)
+	if err == sql.ErrNoRows {
+		return none, errVoucherNotFound
+	}
+	if err != nil {
+		return none, err
+	}
+	if expiresAt.Valid && !expiresAt.Time.After(time.Now()) {
+		return none, errVoucherExpired
+	}
+	if !balance.IsPositive() {
+		return none, errVoucherEmpty
+	}
+
+	applied, _ := vouchers.Apply(balance, due)
+	if applied.IsZero() {
+		return none, nil
+	}
+	balance = balance.Sub(applied)
+
+	_, err = tx.Exec("UPDATE vouchers SET balance = ? WHERE id = ?", balance, voucherID)
+	if err != nil {
+		return none, err
+	}
+	err = recordVoucherTx(tx, voucherID, &bookingID, "redeem", applied.Neg(), balance)
+	if err != nil {
+		return none, err
+	}
+	_, err = tx.Exec("UPDATE bookings SET voucher_amount = voucher_amount + ? WHERE id = ?", applied, bookingID)
+	if err != nil {
+		return none, err
+	}
+	return applied, nil
+}
+
+// restoreVouchersTx puts what a booking took from vouchers back on them, e.g.
+// when it is cancelled. It returns the total restored by voucher.
+func restoreVouchersTx(tx *sql.Tx, bookingID int) (map[int]money.Money, error) {
+	rows, err := tx.Query(`
+		SELECT voucher_id, -SUM(amount)
+		FROM voucher_transactions
+		WHERE booking_id = ? AND kind IN ('redeem', 'restore')
+		GROUP BY voucher_id
+	`, bookingID)
+	if err != nil {
+		return nil, err
+	}
+
+	spent := make(map[int]money.Money)
+	for rows.Next() {
+		var voucherID int
+		amount := noMoney()
+		if err := rows.Scan(&voucherID, &amount); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if amount.IsPositive() {
+			spent[voucherID] = amount
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for voucherID, amount := range spent {
+		balance := noMoney()
+		err := tx.QueryRow("SELECT balance FROM vouchers WHERE id = ? FOR UPDATE", voucherID).Scan(&balance)
+		if err != nil {
+			return nil, err
+		}
+		balance = balance.Add(amount)
+		if _, err := tx.Exec("UPDATE vouchers SET balance = ? WHERE id = ?", balance, voucherID); err != nil {
+			return nil, err
+		}
+		if err := recordVoucherTx(tx, voucherID, &bookingID, "restore", amount, balance); err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = tx.Exec("UPDATE bookings SET voucher_amount = 0 WHERE id = ?", bookingID)
+	return spent, err
+}
+
+// moveVouchersTx restores the vouchers used on one booking and spends them
+// again on another, up to the amount due on it. Used when a booking is
+// exchanged. It returns the amount the vouchers paid on the new booking.
+func moveVouchersTx(tx *sql.Tx, fromBookingID, toBookingID int, due money.Money) (money.Money, error) {
+	paid := noMoney()
+	restored, err := restoreVouchersTx(tx, fromBookingID)
+	if err != nil {
+		return paid, err
+	}
+
+	voucherIDs := make([]int, 0, len(restored))
+	for voucherID := range restored {
+		voucherIDs = append(voucherIDs, voucherID)
+	}
+	sort.Ints(voucherIDs)
+
+	for _, voucherID := range voucherIDs {
+		if !due.IsPositive() {
+			break
+		}
+		var code string
+		if err := tx.QueryRow("SELECT code FROM vouchers WHERE id = ?", voucherID).Scan(&code); err != nil {
+			return paid, err
+		}
+		applied, err := redeemVoucherTx(tx, code, toBookingID, due)
+		// A voucher that expired since can't be spent again; its balance stays
+		// restored
+		if err == errVoucherExpired || err == errVoucherEmpty {
+			continue
+		}
+		if err != nil {
+			return paid, err
+		}
+		paid = paid.Add(applied)
+		due = due.Sub(applied)
+	}
+	return paid, nil
+}
+
+// writeVoucherError turns a voucher error into an HTTP response
+func writeVoucherError(w http.ResponseWriter, err error) {
+	switch err {
+	case errVoucherNotFound:
+		http.Error(w, "Voucher not found", http.StatusBadRequest)
+	case errVoucherExpired, errVoucherEmpty:
+		http.Error(w, "Voucher can't be used: "+err.Error(), http.StatusConflict)
+	default:
+		log.Printf("Error redeeming voucher: %v", err)
+		http.Error(w, "Error redeeming voucher", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,56 @@
+// Package vouchers generates gift voucher codes and works out how much of an
+// order a voucher pays for.
+package vouchers
+
+import (
+	"errors"
+	"strings"
+
+	"cinemabooking/crockford"
+	"cinemabooking/money"
+)
+
+// Length of a code, not counting the dashes it is printed with
+const Length = 16
+
+// ErrInvalidCode is returned for strings that can't be a voucher code.
+var ErrInvalidCode = errors.New("vouchers: invalid code")
+
+// NewCode returns a random voucher code.
+func NewCode() (string, error) {
+	code, err := crockford.Random(Length)
+	if err != nil {
+		return "", err
+	}
+	return string(code), nil
+}
+
+// ParseCode normalises a code as typed by a customer: any case, with optional
+// spaces or dashes, O for 0 and I or L for 1.
+func ParseCode(s string) (string, error) {
+	s, ok := crockford.Normalise(s)
+	if !ok || len(s) != Length {
+		return "", ErrInvalidCode
+	}
+	return s, nil
+}
+
+// Format prints a code in groups of four, as on the printed voucher.
+func Format(code string) string {
+	var groups []string
+	for len(code) > 4 {
+		groups = append(groups, code[:4])
+		code = code[4:]
+	}
+	return strings.Join(append(groups, code), "-")
+}
+
+// Apply works out how much of an amount due a voucher balance covers. It
+// returns the amount taken from the voucher and what is left to pay.
+func Apply(balance, due money.Money) (applied, remaining money.Money) {
+	applied = balance.Min(due)
+	if applied.IsNegative() {
+		applied = money.New(0, applied.Currency)
+	}
+	return applied, due.Sub(applied)
+}
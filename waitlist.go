@@ -0,0 +1,390 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"cinemabooking/seating"
+
+	"github.com/gorilla/mux"
+)
+
+// How long a waitlisted customer has to claim the seats offered to them
+const waitlistClaimWindow = 30 * time.Minute
+
+// How often offers that ran out are passed on to the next in line
+const waitlistSweepInterval = time.Minute
+
+// WaitlistEntry is a customer waiting for seats on a sold-out show
+type WaitlistEntry struct {
+	ID        int    `json:"id"`
+	ShowID    int    `json:"show_id"`
+	UserName  string `json:"user_name"`
+	UserEmail string `json:"user_email"`
+	PartySize int    `json:"party_size"`
+	Status    string `json:"status"` // waiting, offered, claimed, expired
+	Position  int    `json:"position,omitempty"`
+}
+
+// WaitlistOffer is the seats held for a waitlisted customer
+type WaitlistOffer struct {
+	EntryID        int       `json:"entry_id"`
+	ShowID         int       `json:"show_id"`
+	UserEmail      string    `json:"user_email"`
+	SeatIDs        []int     `json:"seat_ids"`
+	ClaimToken     string    `json:"claim_token"`
+	OfferExpiresAt time.Time `json:"offer_expires_at"`
+	Status         string    `json:"status"`
+}
+
+// Add a customer to the waitlist of a show that can't seat their party
+func joinWaitlist(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	showID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid show ID", http.StatusBadRequest)
+		return
+	}
+
+	var entry WaitlistEntry
+	err = json.NewDecoder(r.Body).Decode(&entry)
+	if err != nil {
+		log.Printf("Error decoding request: %v", err)
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	if entry.UserEmail == "" {
+		http.Error(w, "Email is required", http.StatusBadRequest)
+		return
+	}
+	if entry.PartySize < 1 || entry.PartySize > maxPartySize {
+		http.Error(w, "Party size must be between 1 and "+strconv.Itoa(maxPartySize), http.StatusBadRequest)
+		return
+	}
+
+	var showStatus string
+	err = dbConn.QueryRow("SELECT status FROM shows WHERE id = ?", showID).Scan(&showStatus)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Show not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error checking show: %v", err)
+		http.Error(w, "Error checking show", http.StatusInternalServerError)
+		return
+	}
+	if showStatus == "cancelled" {
+		http.Error(w, "Show has been cancelled", http.StatusConflict)
+		return
+	}
+
+	// The waitlist is only for parties that can't book right now
+	if err := releaseExpiredHolds(dbConn, showID); err != nil {
+		log.Printf("Error releasing expired holds: %v", err)
+	}
+	var available int
+	err = dbConn.QueryRow("SELECT COUNT(*) FROM seats WHERE show_id = ? AND status = 'available'", showID).Scan(&available)
+	if err != nil {
+		log.Printf("Error counting seats: %v", err)
+		http.Error(w, "Error counting seats", http.StatusInternalServerError)
+		return
+	}
+	if available >= entry.PartySize {
+		http.Error(w, "Seats are still available for this show", http.StatusConflict)
+		return
+	}
+
+	result, err := dbConn.Exec(`
+		INSERT INTO waitlist_entries (show_id, user_name, user_email, party_size, status)
+		VALUES (?, ?, ?, ?, 'waiting')
+	`, showID, entry.UserName, entry.UserEmail, entry.PartySize)
+	if err != nil {
+		log.Printf("Error adding waitlist entry: %v", err)
+		http.Error(w, "Error joining waitlist", http.StatusInternalServerError)
+		return
+	}
+
+	entryID, err := result.LastInsertId()
+	if err != nil {
+		log.Printf("Error getting waitlist entry ID: %v", err)
+		http.Error(w, "Error joining waitlist", http.StatusInternalServerError)
+		return
+	}
+
+	entry.ID = int(entryID)
+	entry.ShowID = showID
+	entry.Status = "waiting"
+	err = dbConn.QueryRow(`
+		SELECT COUNT(*) FROM waitlist_entries
+		WHERE show_id = ? AND status = 'waiting' AND id <= ?
+	`, showID, entry.ID).Scan(&entry.Position)
+	if err != nil {
+		log.Printf("Error getting waitlist position: %v", err)
+	}
+
+	log.Printf("Added %s to waitlist for show %d (party of %d)", entry.UserEmail, showID, entry.PartySize)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(entry)
+}
+
+// Look up the seats offered under a claim token
+func getWaitlistOffer(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	token := vars["token"]
+
+	var offer WaitlistOffer
+	err := dbConn.QueryRow(`
+		SELECT id, show_id, user_email, claim_token, offer_expires_at, status
+		FROM waitlist_entries
+		WHERE claim_token = ?
+	`, token).Scan(&offer.EntryID, &offer.ShowID, &offer.UserEmail, &offer.ClaimToken, &offer.OfferExpiresAt, &offer.Status)
+	if err != nil {
+		log.Printf("Error fetching waitlist offer: %v", err)
+		http.Error(w, "Offer not found", http.StatusNotFound)
+		return
+	}
+
+	rows, err := dbConn.Query("SELECT id FROM seats WHERE hold_token = ? AND status = 'held'", token)
+	if err != nil {
+		log.Printf("Error fetching offered seats: %v", err)
+		http.Error(w, "Error fetching seats", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var seatID int
+		if err := rows.Scan(&seatID); err != nil {
+			log.Printf("Error scanning seat ID: %v", err)
+			continue
+		}
+		offer.SeatIDs = append(offer.SeatIDs, seatID)
+	}
+
+	offer.OfferExpiresAt = inCinemaTime(offer.OfferExpiresAt)
+	if offer.Status == "offered" && len(offer.SeatIDs) == 0 {
+		offer.Status = "expired"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(offer)
+}
+
+// Make seats available again (staff action) and offer them to the waitlist
+func releaseSeats(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	showID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid show ID", http.StatusBadRequest)
+		return
+	}
+
+	var releaseRequest struct {
+		SeatIDs []int `json:"seat_ids"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&releaseRequest)
+	if err != nil {
+		log.Printf("Error decoding request: %v", err)
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+
+	released := 0
+	for _, seatID := range releaseRequest.SeatIDs {
+		result, err := dbConn.Exec(`
+			UPDATE seats SET status = 'available', booking_id = NULL, hold_token = NULL, held_until = NULL
+			WHERE id = ? AND show_id = ? AND status != 'available'
+		`, seatID, showID)
+		if err != nil {
+			log.Printf("Error releasing seat %d: %v", seatID, err)
+			http.Error(w, "Error releasing seats", http.StatusInternalServerError)
+			return
+		}
+		if n, err := result.RowsAffected(); err == nil {
+			released += int(n)
+		}
+	}
+
+	log.Printf("Released %d seats for show %d", released, showID)
+
+	offers, err := offerWaitlistSeats(showID)
+	if err != nil {
+		log.Printf("Error offering seats to waitlist: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{
+		"released": released,
+		"offered":  len(offers),
+	})
+}
+
+// offerWaitlistSeats expires unclaimed offers for a show and holds free seats
+// for the waiting customers in the order they joined. A party that doesn't
+// fit is skipped but keeps its place for the next release.
+func offerWaitlistSeats(showID int) ([]WaitlistOffer, error) {
+	tx, err := dbConn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var enforceSeatGaps bool
+	var showStatus string
+	err = tx.QueryRow("SELECT enforce_seat_gaps, status FROM shows WHERE id = ? FOR UPDATE", showID).Scan(&enforceSeatGaps, &showStatus)
+	if err != nil {
+		return nil, err
+	}
+	if showStatus == "cancelled" {
+		return nil, nil
+	}
+
+	_, err = tx.Exec("SELECT id FROM seats WHERE show_id = ? FOR UPDATE", showID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = releaseExpiredHolds(tx, showID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE waitlist_entries SET status = 'expired'
+		WHERE show_id = ? AND status = 'offered' AND offer_expires_at < NOW()
+	`, showID)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := waitingEntries(tx, showID)
+	if err != nil {
+		return nil, err
+	}
+
+	var offers []WaitlistOffer
+	for _, entry := range entries {
+		seatRows, err := loadSeatRows(tx, showID, "")
+		if err != nil {
+			return nil, err
+		}
+
+		block, ok := seating.Suggest(seatRows, seating.Preferences{PartySize: entry.PartySize}, seating.DefaultWeights, seatRulesForShow(enforceSeatGaps))
+		if !ok {
+			continue
+		}
+
+		var seatIDs []int
+		for _, seat := range block.Seats {
+			seatIDs = append(seatIDs, seat.ID)
+		}
+
+		token, err := holdSeats(tx, seatIDs, waitlistClaimWindow)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = tx.Exec(`
+			UPDATE waitlist_entries
+			SET status = 'offered', claim_token = ?, offer_expires_at = DATE_ADD(NOW(), INTERVAL ? SECOND)
+			WHERE id = ?
+		`, token, int(waitlistClaimWindow.Seconds()), entry.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		offers = append(offers, WaitlistOffer{
+			EntryID:        entry.ID,
+			ShowID:         showID,
+			UserEmail:      entry.UserEmail,
+			SeatIDs:        seatIDs,
+			ClaimToken:     token,
+			OfferExpiresAt: time.Now().Add(waitlistClaimWindow),
+			Status:         "offered",
+		})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	for _, offer := range offers {
+		log.Printf("Offered %d seats for show %d to %s", len(offer.SeatIDs), offer.ShowID, offer.UserEmail)
+		sendWaitlistOffer(offer)
+	}
+	return offers, nil
+}
+
+// waitingEntries lists the customers still waiting for a show, oldest first
+func waitingEntries(tx *sql.Tx, showID int) ([]WaitlistEntry, error) {
+	rows, err := tx.Query(`
+		SELECT id, show_id, COALESCE(user_name, ''), user_email, party_size, status
+		FROM waitlist_entries
+		WHERE show_id = ? AND status = 'waiting'
+		ORDER BY id
+		FOR UPDATE
+	`, showID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []WaitlistEntry
+	for rows.Next() {
+		var entry WaitlistEntry
+		if err := rows.Scan(&entry.ID, &entry.ShowID, &entry.UserName, &entry.UserEmail, &entry.PartySize, &entry.Status); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// claimWaitlistOffer marks the offer behind a hold token as claimed by a booking
+func claimWaitlistOffer(tx *sql.Tx, holdToken string, bookingID int) error {
+	_, err := tx.Exec(`
+		UPDATE waitlist_entries SET status = 'claimed', booking_id = ?
+		WHERE claim_token = ? AND status = 'offered'
+	`, bookingID, holdToken)
+	return err
+}
+
+// runWaitlistSweeper periodically passes expired offers on to the next
+// customers in line
+func runWaitlistSweeper() {
+	ticker := time.NewTicker(waitlistSweepInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		rows, err := dbConn.Query(`
+			SELECT DISTINCT show_id FROM waitlist_entries
+			WHERE status = 'waiting' OR (status = 'offered' AND offer_expires_at < NOW())
+		`)
+		if err != nil {
+			log.Printf("Error finding waitlisted shows: %v", err)
+			continue
+		}
+
+		var showIDs []int
+		for rows.Next() {
+			var showID int
+			if err := rows.Scan(&showID); err == nil {
+				showIDs = append(showIDs, showID)
+			}
+		}
+		rows.Close()
+
+		for _, showID := range showIDs {
+			if _, err := offerWaitlistSeats(showID); err != nil {
+				log.Printf("Error offering seats for show %d: %v", showID, err)
+			}
+		}
+	}
+}